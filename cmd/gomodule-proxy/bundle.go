@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+	"go.f110.dev/xerrors"
+	"golang.org/x/mod/module"
+
+	"go.f110.dev/gomodule-proxy/cmd/gomodule-proxy/internal/config"
+	"go.f110.dev/gomodule-proxy/internal/gomodule"
+)
+
+func newExportCommand() *cobra.Command {
+	var configPath, moduleDir, cacheDir, output string
+	var files []string
+	upstreams := []string{"https://proxy.golang.org"}
+
+	cmd := &cobra.Command{
+		Use:   "export [module@version...]",
+		Short: "Export the module graph as the bundle for air-gapped environments",
+		Long: `Export the module graph as the bundle for air-gapped environments.
+The bundle is a directory in GOPROXY layout and can be used as GOPROXY=file:///path/to/bundle or loaded by the import command.
+The root modules are given by the arguments or the files (-f). The file is a list of module@version, go.mod, go.sum or go.work.
+The hashes of the modules are verified by the given go.sum files.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if configPath == "" || output == "" {
+				return xerrors.New("--config and --output are required")
+			}
+			conf, err := config.ReadConfig(configPath)
+			if err != nil {
+				return err
+			}
+			if conf.Storage != nil {
+				if !cmd.Flags().Changed("mod-dir") && conf.Storage.ModuleDir != "" {
+					moduleDir = conf.Storage.ModuleDir
+				}
+				if !cmd.Flags().Changed("cache-dir") && conf.Storage.CacheDir != "" {
+					cacheDir = conf.Storage.CacheDir
+				}
+			}
+			if !cmd.Flags().Changed("upstream") && len(conf.Upstreams) > 0 {
+				upstreams = nil
+				for _, v := range conf.Upstreams {
+					upstreams = append(upstreams, v.URL)
+				}
+			}
+			var upstreamURLs []*url.URL
+			for _, v := range upstreams {
+				u, err := url.Parse(v)
+				if err != nil {
+					return xerrors.WithStack(err)
+				}
+				upstreamURLs = append(upstreamURLs, u)
+			}
+
+			var roots []module.Version
+			for _, v := range args {
+				roots = append(roots, gomodule.ParseModuleVersion(v))
+			}
+			sums := make(map[string]string)
+			for _, v := range files {
+				mods, err := gomodule.ReadModuleList(v)
+				if err != nil {
+					return err
+				}
+				roots = append(roots, mods...)
+				if filepath.Base(v) == "go.sum" {
+					s, err := gomodule.ReadGoSum(v)
+					if err != nil {
+						return err
+					}
+					for k, h := range s {
+						sums[k] = h
+					}
+				}
+			}
+			if len(roots) == 0 {
+				return xerrors.New("no module is given")
+			}
+
+			proxy := gomodule.NewModuleProxy(moduleRules(conf), moduleDir, cliRefreshInterval, newArtifactCache(cacheDir), nil, nil)
+			bundler := gomodule.NewBundler(proxy, gomodule.NewUpstream(upstreamURLs), output)
+			exported, err := bundler.Export(cmd.Context(), roots, sums)
+			if err != nil {
+				return err
+			}
+			for _, v := range exported {
+				fmt.Fprintln(cmd.OutOrStdout(), v.String())
+			}
+			fmt.Fprintf(cmd.ErrOrStderr(), "Exported %d modules to %s\n", len(exported), output)
+			return nil
+		},
+	}
+	cmd.Flags().StringVarP(&configPath, "config", "c", configPath, "Configuration file path")
+	cmd.Flags().StringVar(&moduleDir, "mod-dir", moduleDir, "Module directory")
+	cmd.Flags().StringVar(&cacheDir, "cache-dir", cacheDir, "Directory which the artifacts of the private modules are stored into")
+	cmd.Flags().StringSliceVar(&upstreams, "upstream", upstreams, "Upstream module proxy URLs")
+	cmd.Flags().StringVarP(&output, "output", "o", output, "Directory which the bundle is written to")
+	cmd.Flags().StringArrayVarP(&files, "file", "f", files, "File of the root modules (list of module@version, go.mod, go.sum or go.work). Can be specified multiple times")
+
+	return cmd
+}
+
+func newImportCommand() *cobra.Command {
+	var configPath, cacheDir string
+
+	cmd := &cobra.Command{
+		Use:   "import BUNDLE_DIR",
+		Short: "Import the bundle which is created by the export command into the storage",
+		Long: `Import the bundle which is created by the export command into the storage (cache-dir).
+The hashes of the bundle are verified before importing. The imported modules are served before asking the upstream.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if configPath != "" {
+				conf, err := config.ReadConfig(configPath)
+				if err != nil {
+					return err
+				}
+				if !cmd.Flags().Changed("cache-dir") && conf.Storage != nil && conf.Storage.CacheDir != "" {
+					cacheDir = conf.Storage.CacheDir
+				}
+			}
+			if cacheDir == "" {
+				return xerrors.New("--cache-dir or storage.cache_dir in the config is required")
+			}
+
+			n, err := gomodule.ImportBundle(args[0], gomodule.NewArtifactCache(cacheDir))
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.ErrOrStderr(), "Imported %d files into %s\n", n, cacheDir)
+			return nil
+		},
+	}
+	cmd.Flags().StringVarP(&configPath, "config", "c", configPath, "Configuration file path")
+	cmd.Flags().StringVar(&cacheDir, "cache-dir", cacheDir, "Directory which the artifacts are stored into")
+
+	return cmd
+}
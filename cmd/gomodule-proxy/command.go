@@ -2,11 +2,11 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
 	"net/http"
 	"net/url"
 	"os"
 	"os/signal"
-	"regexp"
 	"syscall"
 	"time"
 
@@ -16,6 +16,7 @@ import (
 	"github.com/spf13/pflag"
 	"go.f110.dev/xerrors"
 	"go.uber.org/zap"
+	"golang.org/x/mod/module"
 	"golang.org/x/oauth2"
 
 	"go.f110.dev/gomodule-proxy/cmd/gomodule-proxy/internal/config"
@@ -23,34 +24,96 @@ import (
 )
 
 type goModuleProxyCommand struct {
-	ConfigPath   string
-	ModuleDir    string
-	Addr         string
-	UpstreamURL  string
-	GitHubToken  string
-	GitHubAPIURL string
-
-	logger       logr.Logger
-	upstream     *url.URL
-	config       config.Config
-	githubClient *github.Client
+	ConfigPath        string
+	ConfigReload      time.Duration
+	ModuleDir         string
+	CacheDir          string
+	IndexFile         string
+	RefreshInterval   time.Duration
+	WebhookSecret     string
+	PublicURL         string
+	EnableUI          bool
+	EnableDoc         bool
+	EnableDeps        bool
+	EnableSearch      bool
+	WarmOnStart       bool
+	WarmConcurrency   int
+	Addr              string
+	UpstreamURLs      []string
+	GitHubToken       string
+	GitHubAPIURL      string
+	ReadinessCheckGit bool
+	ShutdownDelay     time.Duration
+	AccessLogFormat   string
+	TraceExporter     string
+	TraceOTLPEndpoint string
+	TraceFile         string
+	TraceSampleRatio  float64
+	TLSCertFile       string
+	TLSKeyFile        string
+	TLSClientCAFile   string
+	TLSRequireClient  bool
+	ReadHeaderTimeout time.Duration
+	ReadTimeout       time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+
+	flags           *pflag.FlagSet
+	logger          logr.Logger
+	upstreams       []*url.URL
+	config          *config.Config
+	githubClient    *github.Client
+	accessLogFormat gomodule.AccessLogFormat
 }
 
 func newGoModuleProxyCommand() *goModuleProxyCommand {
 	return &goModuleProxyCommand{
-		Addr:         ":7589",
-		UpstreamURL:  "https://proxy.golang.org",
-		GitHubAPIURL: "https://api.github.com/",
+		Addr:              ":7589",
+		ConfigReload:      10 * time.Second,
+		UpstreamURLs:      []string{"https://proxy.golang.org"},
+		GitHubAPIURL:      "https://api.github.com/",
+		AccessLogFormat:   string(gomodule.AccessLogFormatLogger),
+		TraceExporter:     traceExporterNone,
+		TraceSampleRatio:  1,
+		ReadHeaderTimeout: 10 * time.Second,
 	}
 }
 
 func (c *goModuleProxyCommand) Flags(fs *pflag.FlagSet) {
+	c.flags = fs
 	fs.StringVarP(&c.ConfigPath, "config", "c", c.ConfigPath, "Configuration file path")
+	fs.DurationVar(&c.ConfigReload, "config-reload-interval", c.ConfigReload, "Interval of checking the modification of the configuration file. The modules are reloaded on SIGHUP too. 0 disables checking")
 	fs.StringVar(&c.ModuleDir, "mod-dir", c.ModuleDir, "Module directory")
+	fs.StringVar(&c.CacheDir, "cache-dir", c.CacheDir, "Directory which the artifacts of the modules are stored into. If empty, the artifacts are not cached")
+	fs.StringVar(&c.IndexFile, "index-file", c.IndexFile, "File which the module index is persisted to. If not empty, /index is enabled")
+	fs.DurationVar(&c.RefreshInterval, "refresh-interval", c.RefreshInterval, "Interval of fetching the repository from the remote. 0 means fetching every time")
+	fs.StringVar(&c.WebhookSecret, "webhook-secret", c.WebhookSecret, "Secret of the webhook. If not empty, /_webhook/github and /_webhook/generic are enabled")
+	fs.StringVar(&c.PublicURL, "public-url", c.PublicURL, "URL of this proxy which is advertised by the go-import meta tag of the vanity import path. If empty, the URL is derived from the request")
+	fs.BoolVar(&c.EnableUI, "enable-ui", c.EnableUI, "Serve the pages for browsing the private modules on /_ui/")
+	fs.BoolVar(&c.EnableDoc, "enable-doc", c.EnableDoc, "Serve the documentation of the private modules on /_doc/{module}@{version}")
+	fs.BoolVar(&c.EnableDeps, "enable-deps", c.EnableDeps, "Serve the dependency graph of the private modules on /_deps/{module} and /_rdeps/{module}")
+	fs.BoolVar(&c.EnableSearch, "enable-search", c.EnableSearch, "Serve the search API over the private modules on /_search. The configured modules are indexed on start and the others when the repository is fetched")
+	fs.BoolVar(&c.WarmOnStart, "warm-on-start", c.WarmOnStart, "Warm the configured modules in the background on startup")
+	fs.IntVar(&c.WarmConcurrency, "warm-concurrency", c.WarmConcurrency, "The number of the modules which are warmed concurrently")
 	fs.StringVar(&c.Addr, "addr", c.Addr, "Listen addr")
-	fs.StringVar(&c.UpstreamURL, "upstream", c.UpstreamURL, "Upstream module proxy URL")
+	fs.StringSliceVar(&c.UpstreamURLs, "upstream", c.UpstreamURLs, "Upstream module proxy URLs. The next one is used when the module is not found")
 	fs.StringVar(&c.GitHubToken, "github-token", c.GitHubToken, "GitHub API token")
 	fs.StringVar(&c.GitHubAPIURL, "github-api-url", c.GitHubAPIURL, "URL of GitHub REST endpoint")
+	fs.BoolVar(&c.ReadinessCheckGit, "readiness-check-git", c.ReadinessCheckGit, "Check the git remote of configured modules in the readiness probe")
+	fs.DurationVar(&c.ShutdownDelay, "shutdown-delay", c.ShutdownDelay, "Duration to keep serving after the readiness probe starts failing on shutdown")
+	fs.StringVar(&c.AccessLogFormat, "access-log-format", c.AccessLogFormat, "Format of the access log (logger, json or combined)")
+	fs.StringVar(&c.TraceExporter, "trace-exporter", c.TraceExporter, "Exporter of traces (none, otlp, stdout or file)")
+	fs.StringVar(&c.TraceOTLPEndpoint, "trace-otlp-endpoint", c.TraceOTLPEndpoint, "URL of OTLP/HTTP endpoint. If empty, OTEL_EXPORTER_OTLP_ENDPOINT is used")
+	fs.StringVar(&c.TraceFile, "trace-file", c.TraceFile, "File path which traces are written to by the file exporter")
+	fs.Float64Var(&c.TraceSampleRatio, "trace-sample-ratio", c.TraceSampleRatio, "Sampling ratio of traces")
+	fs.StringVar(&c.TLSCertFile, "tls-cert", c.TLSCertFile, "Certificate file for serving TLS. The file is reloaded when it is rotated")
+	fs.StringVar(&c.TLSKeyFile, "tls-key", c.TLSKeyFile, "Private key file for serving TLS")
+	fs.StringVar(&c.TLSClientCAFile, "tls-client-ca", c.TLSClientCAFile, "CA bundle file for verifying client certificates")
+	fs.BoolVar(&c.TLSRequireClient, "tls-require-client-cert", c.TLSRequireClient, "Require the client certificate. If false, the client certificate is verified only if given")
+	fs.DurationVar(&c.ReadHeaderTimeout, "read-header-timeout", c.ReadHeaderTimeout, "Timeout of reading the request headers")
+	fs.DurationVar(&c.ReadTimeout, "read-timeout", c.ReadTimeout, "Timeout of reading the request. 0 means no timeout")
+	fs.DurationVar(&c.WriteTimeout, "write-timeout", c.WriteTimeout, "Timeout of writing the response. 0 means no timeout")
+	fs.DurationVar(&c.IdleTimeout, "idle-timeout", c.IdleTimeout, "Timeout of idle keep-alive connections. 0 means no timeout")
 }
 
 func (c *goModuleProxyCommand) RequiredFlags() []string {
@@ -79,12 +142,24 @@ func (c *goModuleProxyCommand) Init() error {
 		return err
 	}
 	c.config = conf
+	c.applyConfig(conf)
 
-	uu, err := url.Parse(c.UpstreamURL)
+	f, err := gomodule.ParseAccessLogFormat(c.AccessLogFormat)
 	if err != nil {
-		return xerrors.WithStack(err)
+		return err
+	}
+	c.accessLogFormat = f
+
+	if len(c.UpstreamURLs) == 0 {
+		return xerrors.New("at least one upstream is required")
+	}
+	for _, v := range c.UpstreamURLs {
+		uu, err := url.Parse(v)
+		if err != nil {
+			return xerrors.WithStack(err)
+		}
+		c.upstreams = append(c.upstreams, uu)
 	}
-	c.upstream = uu
 
 	gu, err := url.Parse(c.GitHubAPIURL)
 	if err != nil {
@@ -112,32 +187,184 @@ func (c *goModuleProxyCommand) Run() error {
 	stopErrCh := make(chan error, 1)
 	startErrCh := make(chan error, 1)
 
-	var modules []*regexp.Regexp
-	for _, v := range c.config {
-		re, err := regexp.Compile(v.ModuleName)
+	tp, err := setupTracerProvider(context.Background(), c.TraceExporter, c.TraceOTLPEndpoint, c.TraceFile, c.TraceSampleRatio)
+	if err != nil {
+		return err
+	}
+	if tp != nil {
+		defer func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := tp.Shutdown(ctx); err != nil {
+				c.logger.Info("Failed to shutdown the tracer provider", xerrors.ZapField(err))
+			}
+		}()
+	}
+
+	var tlsConfig *tls.Config
+	if c.TLSCertFile != "" || c.TLSKeyFile != "" {
+		conf, err := gomodule.NewTLSConfig(c.TLSCertFile, c.TLSKeyFile, c.TLSClientCAFile, c.TLSRequireClient)
 		if err != nil {
-			return xerrors.WithStack(err)
+			return err
 		}
-		modules = append(modules, re)
+		tlsConfig = conf
 	}
-	proxy := gomodule.NewModuleProxy(modules, c.ModuleDir, c.githubClient)
-	server := gomodule.NewProxyServer(c.Addr, c.upstream, proxy, c.logger, c.IsDebug())
 
-	err := xerrors.WithStack(xerrors.New("foo"))
-	c.logger.Info("Foobar", xerrors.ZapField(err))
+	var auth *gomodule.Authenticator
+	switch {
+	case c.config.Auth != nil:
+		a, err := c.newAuthenticator(c.config.Auth)
+		if err != nil {
+			return err
+		}
+		auth = a
+	case c.TLSClientCAFile != "":
+		// Authenticate the clients by the certificate only
+		a, err := gomodule.NewAuthenticator(nil, nil, nil, nil, false)
+		if err != nil {
+			return err
+		}
+		auth = a
+	}
+
+	metrics := gomodule.NewMetrics()
+	proxy := gomodule.NewModuleProxy(moduleRules(c.config), c.ModuleDir, c.RefreshInterval, newArtifactCache(c.CacheDir), c.githubClient, metrics)
+	proxy.SetForks(forkRules(c.config))
+	var index *gomodule.ModuleIndex
+	var notifier *gomodule.Notifier
+	if c.IndexFile != "" {
+		index, err = gomodule.OpenModuleIndex(c.IndexFile)
+		if err != nil {
+			return err
+		}
+		notifier = c.newNotifier()
+		indexLogger := c.logger.WithName("index")
+		proxy.AddObserver(func(root *gomodule.ModuleRoot) {
+			added, err := index.Observe(root)
+			if err != nil {
+				indexLogger.Info("Failed to update the index", "repository", root.RootPath, xerrors.ZapField(err))
+				return
+			}
+			for _, v := range added {
+				indexLogger.Info("New version", "module", v.Path, "version", v.Version)
+			}
+			if notifier != nil {
+				for _, ev := range gomodule.NewVersionEvents(root, added, index.FirstSeen) {
+					notifier.Notify(ev)
+				}
+			}
+		})
+	}
+	health := gomodule.NewHealthChecker()
+	health.AddCheck("mod_dir", gomodule.DirWritableCheck(c.ModuleDir))
+	for i, v := range c.upstreams {
+		name := "upstream"
+		if i > 0 {
+			name = "upstream:" + v.Host
+		}
+		health.AddCheck(name, gomodule.UpstreamCheck(v))
+	}
+	if c.ReadinessCheckGit {
+		for _, v := range proxy.ConfiguredModules() {
+			health.AddCheck("git:"+v, proxy.GitRemoteCheck(v))
+		}
+	}
+	server := gomodule.NewProxyServer(
+		c.Addr,
+		tlsConfig,
+		gomodule.ServerTimeouts{ReadHeader: c.ReadHeaderTimeout, Read: c.ReadTimeout, Write: c.WriteTimeout, Idle: c.IdleTimeout},
+		c.upstreams,
+		proxy,
+		auth,
+		metrics,
+		health,
+		c.accessLogFormat,
+		c.logger,
+		c.IsDebug(),
+	)
+	if v := c.config.Quarantine; v != nil {
+		server.SetQuarantine(gomodule.NewQuarantine(gomodule.NewUpstream(c.upstreams), time.Duration(v.Duration), v.BlockRequested, v.ExcludeMatches()))
+	}
+	if c.WebhookSecret != "" {
+		webhook, err := gomodule.NewWebhookHandler(proxy, c.WebhookSecret, c.logger.WithName("webhook"))
+		if err != nil {
+			return err
+		}
+		server.Mount("/_webhook/", webhook.Handler())
+	}
+	var publicURL *url.URL
+	if c.PublicURL != "" {
+		u, err := url.Parse(c.PublicURL)
+		if err != nil {
+			return xerrors.WithStack(err)
+		}
+		publicURL = u
+	}
+	server.HandleGoGet(gomodule.NewVanityHandler(proxy, auth, publicURL, c.logger.WithName("vanity")))
+	if index != nil {
+		server.Handle("/index", gomodule.NewIndexHandler(index, proxy, auth, c.logger.WithName("index")).Handler())
+	}
+	if c.EnableUI {
+		server.Mount("/_ui/", gomodule.NewUIHandler(proxy, auth, c.logger.WithName("ui")).Handler())
+	}
+	if c.EnableDoc {
+		server.Mount("/_doc/", gomodule.NewDocHandler(proxy, auth, c.logger.WithName("doc")).Handler())
+	}
+	var deps *gomodule.DepsHandler
+	if c.EnableDeps {
+		deps = gomodule.NewDepsHandler(proxy, auth, c.logger.WithName("deps"))
+		h := deps.Handler()
+		server.Mount("/_deps/", h)
+		server.Mount("/_rdeps/", h)
+	}
+	if v := c.config.Admin; v != nil {
+		admin, err := gomodule.NewAdminHandler(proxy, auth, v.Users, v.Groups, c.logger.WithName("admin"))
+		if err != nil {
+			return err
+		}
+		server.Mount("/_admin/", admin.Handler())
+	}
 
 	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	var search *gomodule.SearchIndex
+	if c.EnableSearch {
+		// The modules are indexed in the background until the server is shutting down
+		search = gomodule.NewSearchIndex(ctx, proxy, c.logger.WithName("search"))
+		proxy.AddObserver(search.Observe)
+		server.Handle("/_search", gomodule.NewSearchHandler(search, proxy, auth, c.logger.WithName("search")).Handler())
+	}
+	go newConfigReloader(c.ConfigPath, c.ConfigReload, proxy, c.logger).Run(ctx)
+	if c.WarmOnStart {
+		go c.warm(ctx, proxy)
+	}
+	// Both of the search index and the reverse dependencies are built from the fetched repositories, so they are seeded once
+	switch {
+	case search != nil:
+		go search.Seed(ctx)
+	case deps != nil:
+		go deps.Seed(ctx)
+	}
 	go func() {
 		defer cancel()
 
 		select {
 		case <-ctx.Done():
+			health.ShuttingDown()
+			if c.ShutdownDelay > 0 {
+				c.logger.Info("Waiting for the readiness probe to be observed", "delay", c.ShutdownDelay)
+				time.Sleep(c.ShutdownDelay)
+			}
+
 			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 			c.logger.Info("Shutting down server")
 			if err := server.Stop(ctx); err != nil {
 				stopErrCh <- err
 			}
 			cancel()
+			if notifier != nil {
+				c.logger.Info("Waiting for the notifications to be sent")
+				notifier.Wait()
+			}
 			c.logger.Info("Server shutdown successfully")
 			close(stopErrCh)
 		case <-stopErrCh:
@@ -167,6 +394,152 @@ func (c *goModuleProxyCommand) Run() error {
 	return nil
 }
 
+// warm warms the latest version of the configured modules.
+func (c *goModuleProxyCommand) warm(ctx context.Context, proxy *gomodule.ModuleProxy) {
+	var mods []module.Version
+	for _, v := range proxy.ConfiguredModules() {
+		mods = append(mods, module.Version{Path: v})
+	}
+	c.logger.Info("Warming the modules", "count", len(mods))
+	proxy.WarmModules(ctx, mods, c.WarmConcurrency, func(mod module.Version, err error) {
+		if err != nil {
+			c.logger.Info("Failed to warm the module", "module", mod.Path, xerrors.ZapField(err))
+			return
+		}
+		c.logger.V(1).Info("Warmed the module", "module", mod.Path)
+	})
+	c.logger.Info("Finished warming the modules")
+}
+
+// applyConfig overwrites the fields by the config file.
+// The flags which are specified explicitly take precedence over the config file.
+func (c *goModuleProxyCommand) applyConfig(conf *config.Config) {
+	if v := conf.Server; v != nil {
+		c.overrideString("addr", &c.Addr, v.Addr)
+		c.overrideString("access-log-format", &c.AccessLogFormat, v.AccessLogFormat)
+		c.overrideDuration("read-header-timeout", &c.ReadHeaderTimeout, v.ReadHeaderTimeout)
+		c.overrideDuration("read-timeout", &c.ReadTimeout, v.ReadTimeout)
+		c.overrideDuration("write-timeout", &c.WriteTimeout, v.WriteTimeout)
+		c.overrideDuration("idle-timeout", &c.IdleTimeout, v.IdleTimeout)
+		c.overrideDuration("shutdown-delay", &c.ShutdownDelay, v.ShutdownDelay)
+		c.overrideString("public-url", &c.PublicURL, v.PublicURL)
+		if v.EnableUI && !c.flags.Changed("enable-ui") {
+			c.EnableUI = true
+		}
+		if v.EnableDoc && !c.flags.Changed("enable-doc") {
+			c.EnableDoc = true
+		}
+		if v.EnableDeps && !c.flags.Changed("enable-deps") {
+			c.EnableDeps = true
+		}
+		if v.EnableSearch && !c.flags.Changed("enable-search") {
+			c.EnableSearch = true
+		}
+		if v.TLS != nil {
+			c.overrideString("tls-cert", &c.TLSCertFile, v.TLS.CertFile)
+			c.overrideString("tls-key", &c.TLSKeyFile, v.TLS.KeyFile)
+			c.overrideString("tls-client-ca", &c.TLSClientCAFile, v.TLS.ClientCAFile)
+			if !c.flags.Changed("tls-require-client-cert") {
+				c.TLSRequireClient = v.TLS.RequireClientCert
+			}
+		}
+	}
+	if len(conf.Upstreams) > 0 && !c.flags.Changed("upstream") {
+		c.UpstreamURLs = nil
+		for _, v := range conf.Upstreams {
+			c.UpstreamURLs = append(c.UpstreamURLs, v.URL)
+		}
+	}
+	if v := conf.GitHub; v != nil {
+		c.overrideString("github-token", &c.GitHubToken, v.Token)
+		c.overrideString("github-api-url", &c.GitHubAPIURL, v.APIURL)
+	}
+	if v := conf.Webhook; v != nil {
+		c.overrideString("webhook-secret", &c.WebhookSecret, v.Secret)
+	}
+	if v := conf.Storage; v != nil {
+		c.overrideString("mod-dir", &c.ModuleDir, v.ModuleDir)
+		c.overrideString("cache-dir", &c.CacheDir, v.CacheDir)
+		c.overrideString("index-file", &c.IndexFile, v.IndexFile)
+		c.overrideDuration("refresh-interval", &c.RefreshInterval, v.RefreshInterval)
+		if v.WarmOnStart && !c.flags.Changed("warm-on-start") {
+			c.WarmOnStart = true
+		}
+		if v.WarmConcurrency > 0 && !c.flags.Changed("warm-concurrency") {
+			c.WarmConcurrency = v.WarmConcurrency
+		}
+	}
+}
+
+func (c *goModuleProxyCommand) overrideString(flag string, dst *string, v string) {
+	if v != "" && !c.flags.Changed(flag) {
+		*dst = v
+	}
+}
+
+func (c *goModuleProxyCommand) overrideDuration(flag string, dst *time.Duration, v config.Duration) {
+	if v != 0 && !c.flags.Changed(flag) {
+		*dst = time.Duration(v)
+	}
+}
+
+func (c *goModuleProxyCommand) newNotifier() *gomodule.Notifier {
+	conf := c.config.Notifications
+	if conf == nil || len(conf.Targets) == 0 {
+		return nil
+	}
+
+	var targets []*gomodule.NotificationTarget
+	for _, v := range conf.Targets {
+		targets = append(targets, &gomodule.NotificationTarget{Match: v.Match(), URL: v.URL, Secret: v.Secret})
+	}
+	return gomodule.NewNotifier(targets, conf.MaxRetries, conf.DeadLetterFile, c.logger.WithName("notifier"))
+}
+
+func (c *goModuleProxyCommand) newAuthenticator(conf *config.AuthConfig) (*gomodule.Authenticator, error) {
+	var tokens []gomodule.BearerToken
+	for _, v := range conf.Tokens {
+		tokens = append(tokens, gomodule.BearerToken{Name: v.Name, Token: v.Token})
+	}
+	var users []gomodule.BasicUser
+	for _, v := range conf.Users {
+		users = append(users, gomodule.BasicUser{Name: v.Name, PasswordHash: v.Password})
+	}
+	if conf.HtpasswdFile != "" {
+		u, err := gomodule.ReadHtpasswdFile(conf.HtpasswdFile)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, u...)
+	}
+
+	var jwtVerifier *gomodule.JWTVerifier
+	if len(conf.OIDC) > 0 {
+		var issuers []gomodule.JWTIssuer
+		for _, v := range conf.OIDC {
+			iss := gomodule.JWTIssuer{
+				Issuer:        v.Issuer,
+				Audiences:     v.Audiences,
+				JWKSURL:       v.JWKSURL,
+				JWKSFile:      v.JWKSFile,
+				UsernameClaim: v.UsernameClaim,
+				GroupsClaim:   v.GroupsClaim,
+			}
+			for _, g := range v.ClaimGroups {
+				iss.ClaimGroups = append(iss.ClaimGroups, gomodule.JWTClaimGroup{Claim: g.Claim, Value: g.Value, Group: g.Group})
+			}
+			issuers = append(issuers, iss)
+		}
+		v, err := gomodule.NewJWTVerifier(issuers)
+		if err != nil {
+			return nil, err
+		}
+		jwtVerifier = v
+	}
+
+	return gomodule.NewAuthenticator(tokens, users, conf.Groups, jwtVerifier, conf.AnonymousUpstream)
+}
+
 func (c *goModuleProxyCommand) IsDebug() bool {
 	return os.Getenv("DEBUG") != ""
 }
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"go.f110.dev/xerrors"
+	"gopkg.in/yaml.v2"
+
+	"go.f110.dev/gomodule-proxy/cmd/gomodule-proxy/internal/config"
+)
+
+func newConfigCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "config",
+		Short: "Utilities for the configuration file",
+	}
+
+	var configPath string
+	validate := &cobra.Command{
+		Use:   "validate",
+		Short: "Validate the configuration file and print the normalized configuration",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			if configPath == "" {
+				return xerrors.New("--config is required")
+			}
+			conf, err := config.ReadConfig(configPath)
+			if err != nil {
+				return err
+			}
+			for _, v := range conf.Warnings() {
+				fmt.Fprintf(cmd.ErrOrStderr(), "warning: %s\n", v)
+			}
+
+			buf, err := yaml.Marshal(conf.Redacted())
+			if err != nil {
+				return xerrors.WithStack(err)
+			}
+			_, err = cmd.OutOrStdout().Write(buf)
+			return err
+		},
+	}
+	validate.Flags().StringVarP(&configPath, "config", "c", configPath, "Configuration file path")
+
+	schema := &cobra.Command{
+		Use:   "schema",
+		Short: "Print JSON Schema of the configuration file",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			_, err := cmd.OutOrStdout().Write(config.Schema)
+			return err
+		},
+	}
+
+	cmd.AddCommand(validate, schema)
+	return cmd
+}
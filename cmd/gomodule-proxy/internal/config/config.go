@@ -1,8 +1,12 @@
 package config
 
 import (
+	"bytes"
 	"os"
+	"reflect"
 	"regexp"
+	"strings"
+	"time"
 
 	"go.f110.dev/xerrors"
 	"gopkg.in/yaml.v2"
@@ -10,29 +14,351 @@ import (
 
 type ModuleSetting struct {
 	ModuleName string `yaml:"module_name"`
+	// AllowedUsers and AllowedGroups restrict the clients which can access to the module.
+	// If both are empty, any client can access to the module.
+	AllowedUsers  []string `yaml:"allowed_users,omitempty"`
+	AllowedGroups []string `yaml:"allowed_groups,omitempty"`
+	// Repository is the URL of the git repository for the vanity import path.
+	// If it is not empty, ModuleName has to be the literal import path prefix (e.g. go.example.com/foo).
+	Repository string `yaml:"repository,omitempty"`
 
 	match *regexp.Regexp
 }
 
-type Config []*ModuleSetting
+// Match returns the compiled pattern of ModuleName. It is nil until the config is read by ReadConfig.
+// If Repository is not empty, the pattern matches ModuleName and the paths under it only.
+func (m *ModuleSetting) Match() *regexp.Regexp {
+	return m.match
+}
+
+type Config struct {
+	Server    *ServerConfig     `yaml:"server,omitempty"`
+	Upstreams []*UpstreamConfig `yaml:"upstreams,omitempty"`
+	GitHub    *GitHubConfig     `yaml:"github,omitempty"`
+	Storage   *StorageConfig    `yaml:"storage,omitempty"`
+	Webhook   *WebhookConfig    `yaml:"webhook,omitempty"`
+	Admin     *AdminConfig      `yaml:"admin,omitempty"`
+	// Notifications requires Storage.IndexFile because the new versions are found by the index.
+	Notifications *NotificationsConfig `yaml:"notifications,omitempty"`
+	Auth          *AuthConfig          `yaml:"auth,omitempty"`
+	Modules       []*ModuleSetting     `yaml:"modules"`
+	// Forks substitute the fork repositories for the public modules.
+	Forks []*ForkSetting `yaml:"forks,omitempty"`
+	// Quarantine hides the versions of the upstream modules which were published recently.
+	Quarantine *QuarantineConfig `yaml:"quarantine,omitempty"`
+}
+
+type ServerConfig struct {
+	Addr              string     `yaml:"addr,omitempty"`
+	TLS               *TLSConfig `yaml:"tls,omitempty"`
+	ReadHeaderTimeout Duration   `yaml:"read_header_timeout,omitempty"`
+	ReadTimeout       Duration   `yaml:"read_timeout,omitempty"`
+	WriteTimeout      Duration   `yaml:"write_timeout,omitempty"`
+	IdleTimeout       Duration   `yaml:"idle_timeout,omitempty"`
+	// ShutdownDelay is the duration to keep serving after the readiness probe starts failing on shutdown.
+	ShutdownDelay   Duration `yaml:"shutdown_delay,omitempty"`
+	AccessLogFormat string   `yaml:"access_log_format,omitempty"`
+	// PublicURL is the URL of this proxy which is advertised by the go-import meta tag of the vanity import path.
+	// If empty, the URL is derived from the request.
+	PublicURL string `yaml:"public_url,omitempty"`
+	// EnableUI enables the pages for browsing the private modules (/_ui/).
+	EnableUI bool `yaml:"enable_ui,omitempty"`
+	// EnableDoc enables the documentation of the private modules (/_doc/).
+	EnableDoc bool `yaml:"enable_doc,omitempty"`
+	// EnableDeps enables the dependency graph of the private modules (/_deps/ and /_rdeps/).
+	EnableDeps bool `yaml:"enable_deps,omitempty"`
+	// EnableSearch enables the search API of the private modules (/_search).
+	EnableSearch bool `yaml:"enable_search,omitempty"`
+}
+
+type TLSConfig struct {
+	CertFile          string `yaml:"cert_file"`
+	KeyFile           string `yaml:"key_file"`
+	ClientCAFile      string `yaml:"client_ca_file,omitempty"`
+	RequireClientCert bool   `yaml:"require_client_cert,omitempty"`
+}
+
+// UpstreamConfig is the module proxy which serves the modules not configured in Modules.
+// The upstreams are tried in order and the next one is used when the module is not found.
+type UpstreamConfig struct {
+	URL string `yaml:"url"`
+}
+
+// QuarantineConfig hides the versions of the upstream modules which were published less than Duration ago from list and @latest.
+type QuarantineConfig struct {
+	Duration Duration `yaml:"duration"`
+	// BlockRequested also blocks the version which is requested explicitly (.info, .mod and .zip).
+	BlockRequested bool `yaml:"block_requested,omitempty"`
+	// Exclude is the patterns of the modules which are not quarantined.
+	Exclude []string `yaml:"exclude,omitempty"`
+
+	exclude []*regexp.Regexp
+}
+
+// ExcludeMatches returns the compiled patterns of Exclude. It is nil until the config is read by ReadConfig.
+func (q *QuarantineConfig) ExcludeMatches() []*regexp.Regexp {
+	return q.exclude
+}
+
+type GitHubConfig struct {
+	Token  string `yaml:"token,omitempty"`
+	APIURL string `yaml:"api_url,omitempty"`
+}
+
+type StorageConfig struct {
+	// ModuleDir is the directory which git repositories are cloned into.
+	ModuleDir string `yaml:"mod_dir,omitempty"`
+	// CacheDir is the directory which the artifacts (.info, .mod and .zip) are stored into with GOPROXY layout.
+	// If empty, the artifacts are not cached.
+	CacheDir string `yaml:"cache_dir,omitempty"`
+	// RefreshInterval is the interval of fetching the repository from the remote.
+	// The repository is fetched every time if it is zero.
+	RefreshInterval Duration `yaml:"refresh_interval,omitempty"`
+	// WarmOnStart warms the configured modules in the background when the server starts.
+	WarmOnStart     bool `yaml:"warm_on_start,omitempty"`
+	WarmConcurrency int  `yaml:"warm_concurrency,omitempty"`
+	// IndexFile is the file which the module index (/index) is persisted to. If empty, the index is disabled.
+	IndexFile string `yaml:"index_file,omitempty"`
+}
+
+// WebhookConfig enables the endpoints which receive the webhook of the push (/_webhook/github and /_webhook/generic).
+type WebhookConfig struct {
+	// Secret is the key of HMAC-SHA256 signature.
+	Secret string `yaml:"secret"`
+}
 
-func ReadConfig(path string) (Config, error) {
-	f, err := os.Open(path)
+// AdminConfig enables the admin API (/_admin). The clients are authenticated by the auth section.
+type AdminConfig struct {
+	Users  []string `yaml:"users,omitempty"`
+	Groups []string `yaml:"groups,omitempty"`
+}
+
+// NotificationsConfig posts the new versions of the private modules to the targets.
+type NotificationsConfig struct {
+	Targets []*NotificationTarget `yaml:"targets"`
+	// MaxRetries is the number of the retries of the failed notification. If zero, the default value is used.
+	MaxRetries int `yaml:"max_retries,omitempty"`
+	// DeadLetterFile is the file which the notifications failed finally are appended to.
+	DeadLetterFile string `yaml:"dead_letter_file,omitempty"`
+}
+
+type NotificationTarget struct {
+	// ModuleName is the pattern of the modules which are notified to URL.
+	ModuleName string `yaml:"module_name"`
+	URL        string `yaml:"url"`
+	// Secret is the key of HMAC-SHA256 signature (X-Signature-256). If empty, the request is not signed.
+	Secret string `yaml:"secret,omitempty"`
+
+	match *regexp.Regexp
+}
+
+// Match returns the compiled pattern of ModuleName. It is nil until the config is read by ReadConfig.
+func (t *NotificationTarget) Match() *regexp.Regexp {
+	return t.match
+}
+
+// ForkSetting serves the tags of the fork repository under the module path of the upstream.
+// The versions of the fork have Suffix (e.g. v1.2.3-fork) and the other versions are served by the upstream.
+//
+// The checksum database (sum.golang.org) doesn't know the versions of the fork, and the go command fails with "verifying module".
+// The clients have to exclude the module from the verification by GONOSUMDB (e.g. GONOSUMDB=github.com/upstream/foo).
+// GONOSUMCHECK=1 also works but it disables the verification of all modules.
+//
+// The version of the fork is a pre-release version which sorts below the release version of the same tag (v1.2.3-fork < v1.2.3).
+// If any dependency requires the release version (or later), the minimal version selection picks it and the fork is not used silently.
+// Use a replace directive in go.mod, or tag the fork with a higher version than the release version which is required.
+type ForkSetting struct {
+	// Module is the module path of the upstream.
+	Module     string `yaml:"module"`
+	Repository string `yaml:"repository"`
+	// MinVersion (inclusive) and MaxVersion (exclusive) are the range of the tags which are served. If empty, the range is not bounded.
+	MinVersion string `yaml:"min_version,omitempty"`
+	MaxVersion string `yaml:"max_version,omitempty"`
+	// Suffix is added to the version of the fork. If empty, "fork" is used.
+	Suffix string `yaml:"suffix,omitempty"`
+}
+
+// Duration is time.Duration which is written as a string (e.g. "30s") in YAML.
+type Duration time.Duration
+
+func (d *Duration) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+	v, err := time.ParseDuration(s)
 	if err != nil {
-		return nil, xerrors.WithStack(err)
+		return xerrors.WithStack(err)
+	}
+	*d = Duration(v)
+
+	return nil
+}
+
+func (d Duration) MarshalYAML() (interface{}, error) {
+	return time.Duration(d).String(), nil
+}
+
+type AuthConfig struct {
+	// SecretFile is a path to the file which has the credentials.
+	// The file has the same schema as Credentials and the credentials in it are added to the config.
+	SecretFile string `yaml:"secret_file,omitempty"`
+	// HtpasswdFile is a path to the htpasswd file for basic authentication.
+	HtpasswdFile string `yaml:"htpasswd_file,omitempty"`
+	// AnonymousUpstream allows the request for the module which is served by the upstream without credentials.
+	AnonymousUpstream bool `yaml:"anonymous_upstream,omitempty"`
+	// Groups is the map of the group name to the names of the members.
+	Groups map[string][]string `yaml:"groups,omitempty"`
+	// OIDC is the list of the trusted issuers of JWT bearer tokens.
+	OIDC []*OIDCIssuer `yaml:"oidc,omitempty"`
+
+	Credentials `yaml:",inline"`
+}
+
+type Credentials struct {
+	Tokens []*TokenCredential `yaml:"tokens,omitempty"`
+	Users  []*UserCredential  `yaml:"users,omitempty"`
+}
+
+type TokenCredential struct {
+	Name  string `yaml:"name"`
+	Token string `yaml:"token"`
+}
+
+type OIDCIssuer struct {
+	Issuer string `yaml:"issuer"`
+	// Audiences are the accepted values of the "aud" claim. At least one audience is required.
+	Audiences []string `yaml:"audiences"`
+	// JWKSURL is the URL of JWK Set. If both JWKSURL and JWKSFile are empty, the URL is discovered from the issuer.
+	JWKSURL  string `yaml:"jwks_url,omitempty"`
+	JWKSFile string `yaml:"jwks_file,omitempty"`
+	// UsernameClaim is the claim which is used as the user name. The default is "sub".
+	// The user name is prefixed with the issuer and "|" (e.g. "https://issuer.example.com|alice").
+	// Use the prefixed name in allowed_users, admin.users and groups.
+	UsernameClaim string `yaml:"username_claim,omitempty"`
+	GroupsClaim   string `yaml:"groups_claim,omitempty"`
+	// ClaimGroups adds the group to the identity when the claim has the value.
+	ClaimGroups []*ClaimGroup `yaml:"claim_groups,omitempty"`
+}
+
+type ClaimGroup struct {
+	Claim string `yaml:"claim"`
+	Value string `yaml:"value"`
+	Group string `yaml:"group"`
+}
+
+type UserCredential struct {
+	Name string `yaml:"name"`
+	// Password is a hashed password in the htpasswd format (bcrypt or SHA1).
+	Password string `yaml:"password"`
+}
+
+// UnmarshalYAML accepts the list of ModuleSetting as the legacy format in addition to the mapping.
+func (c *Config) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var modules []*ModuleSetting
+	if err := unmarshal(&modules); err == nil {
+		c.Modules = modules
+		return nil
 	}
 
-	var conf Config
-	if err := yaml.NewDecoder(f).Decode(&conf); err != nil {
-		return nil, xerrors.WithStack(err)
+	type plain Config
+	return unmarshal((*plain)(c))
+}
+
+// ReadConfig reads the config file.
+// ${NAME} in the string values is replaced with the value of the environment variable after parsing,
+// so the value of the environment variable is never interpreted as YAML.
+func ReadConfig(path string) (*Config, error) {
+	conf := &Config{}
+	if err := decodeFile(path, conf); err != nil {
+		return nil, err
+	}
+	if err := conf.Validate(); err != nil {
+		return nil, err
 	}
-	for _, v := range conf {
-		re, err := regexp.Compile(v.ModuleName)
+	if conf.Auth != nil && conf.Auth.SecretFile != "" {
+		creds, err := readCredentials(conf.Auth.SecretFile)
 		if err != nil {
-			return nil, xerrors.WithStack(err)
+			return nil, err
 		}
-		v.match = re
+		conf.Auth.Tokens = append(conf.Auth.Tokens, creds.Tokens...)
+		conf.Auth.Users = append(conf.Auth.Users, creds.Users...)
 	}
 
 	return conf, nil
 }
+
+func readCredentials(path string) (*Credentials, error) {
+	creds := &Credentials{}
+	if err := decodeFile(path, creds); err != nil {
+		return nil, err
+	}
+
+	return creds, nil
+}
+
+// decodeFile decodes the YAML file strictly into v and expands ${NAME} in the string values of v.
+func decodeFile(path string, v interface{}) error {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return xerrors.WithStack(err)
+	}
+	d := yaml.NewDecoder(bytes.NewReader(buf))
+	d.SetStrict(true)
+	if err := d.Decode(v); err != nil {
+		return xerrors.WithStack(err)
+	}
+
+	var missing []string
+	expandEnv(reflect.ValueOf(v), &missing)
+	if len(missing) > 0 {
+		return xerrors.Newf("environment variable is not set: %s", strings.Join(missing, ", "))
+	}
+
+	return nil
+}
+
+var envPattern = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// expandEnv replaces ${NAME} in the exported string fields, the slices and the values of the maps with the environment variable.
+// $NAME is not expanded because it may be a part of the regular expression.
+// The names of the environment variables which are not set are appended to missing.
+func expandEnv(v reflect.Value, missing *[]string) {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if !v.IsNil() {
+			expandEnv(v.Elem(), missing)
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).IsExported() {
+				expandEnv(v.Field(i), missing)
+			}
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			expandEnv(v.Index(i), missing)
+		}
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			// The value of the map is not addressable
+			e := reflect.New(iter.Value().Type()).Elem()
+			e.Set(iter.Value())
+			expandEnv(e, missing)
+			v.SetMapIndex(iter.Key(), e)
+		}
+	case reflect.String:
+		if !v.CanSet() {
+			return
+		}
+		v.SetString(envPattern.ReplaceAllStringFunc(v.String(), func(s string) string {
+			name := envPattern.FindStringSubmatch(s)[1]
+			val, ok := os.LookupEnv(name)
+			if !ok {
+				*missing = append(*missing, name)
+			}
+			return val
+		}))
+	}
+}
@@ -0,0 +1,113 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadConfig(t *testing.T) {
+	t.Run("Legacy", func(t *testing.T) {
+		dir := t.TempDir()
+		err := os.WriteFile(filepath.Join(dir, "config.yaml"), []byte("- module_name: github.com/f110/gomodule-proxy\n"), 0644)
+		require.NoError(t, err)
+
+		conf, err := ReadConfig(filepath.Join(dir, "config.yaml"))
+		require.NoError(t, err)
+		require.Len(t, conf.Modules, 1)
+		assert.Equal(t, "github.com/f110/gomodule-proxy", conf.Modules[0].ModuleName)
+		assert.Nil(t, conf.Auth)
+	})
+
+	t.Run("Auth", func(t *testing.T) {
+		dir := t.TempDir()
+		err := os.WriteFile(filepath.Join(dir, "secret.yaml"), []byte("tokens:\n  - name: ci\n    token: foobar\n"), 0600)
+		require.NoError(t, err)
+		err = os.WriteFile(filepath.Join(dir, "config.yaml"), []byte(`modules:
+  - module_name: github.com/f110/gomodule-proxy
+auth:
+  secret_file: `+filepath.Join(dir, "secret.yaml")+`
+  anonymous_upstream: true
+  users:
+    - name: alice
+      password: "{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g="
+`), 0644)
+		require.NoError(t, err)
+
+		conf, err := ReadConfig(filepath.Join(dir, "config.yaml"))
+		require.NoError(t, err)
+		require.Len(t, conf.Modules, 1)
+		require.NotNil(t, conf.Auth)
+		assert.True(t, conf.Auth.AnonymousUpstream)
+		require.Len(t, conf.Auth.Users, 1)
+		assert.Equal(t, "alice", conf.Auth.Users[0].Name)
+		require.Len(t, conf.Auth.Tokens, 1)
+		assert.Equal(t, "ci", conf.Auth.Tokens[0].Name)
+		assert.Equal(t, "foobar", conf.Auth.Tokens[0].Token)
+	})
+}
+
+func TestReadConfig_Structured(t *testing.T) {
+	t.Setenv("GOMODULE_PROXY_TEST_TOKEN", "foobar")
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, "config.yaml"), []byte(`server:
+  addr: :8080
+  read_header_timeout: 5s
+upstreams:
+  - url: https://proxy.example.com
+  - url: https://proxy.golang.org
+github:
+  token: ${GOMODULE_PROXY_TEST_TOKEN}
+storage:
+  mod_dir: /var/lib/gomodule-proxy
+modules:
+  - module_name: ^github.com/f110/gomodule-proxy$
+`), 0644)
+	require.NoError(t, err)
+
+	conf, err := ReadConfig(filepath.Join(dir, "config.yaml"))
+	require.NoError(t, err)
+	assert.Equal(t, ":8080", conf.Server.Addr)
+	assert.Equal(t, Duration(5*time.Second), conf.Server.ReadHeaderTimeout)
+	require.Len(t, conf.Upstreams, 2)
+	assert.Equal(t, "https://proxy.example.com", conf.Upstreams[0].URL)
+	assert.Equal(t, "foobar", conf.GitHub.Token)
+	assert.Equal(t, "/var/lib/gomodule-proxy", conf.Storage.ModuleDir)
+	require.Len(t, conf.Modules, 1)
+	assert.Equal(t, "^github.com/f110/gomodule-proxy$", conf.Modules[0].ModuleName)
+
+	// The value of the environment variable is not interpreted as YAML
+	t.Setenv("GOMODULE_PROXY_TEST_TOKEN", "foo # bar: baz\nserver:")
+	conf, err = ReadConfig(filepath.Join(dir, "config.yaml"))
+	require.NoError(t, err)
+	assert.Equal(t, "foo # bar: baz\nserver:", conf.GitHub.Token)
+	assert.Equal(t, ":8080", conf.Server.Addr)
+
+	err = os.WriteFile(filepath.Join(dir, "config.yaml"), []byte("github:\n  token: ${GOMODULE_PROXY_TEST_UNDEFINED}\n"), 0644)
+	require.NoError(t, err)
+	_, err = ReadConfig(filepath.Join(dir, "config.yaml"))
+	assert.Error(t, err)
+}
+
+func TestReadConfig_Invalid(t *testing.T) {
+	cases := map[string]string{
+		"InvalidPattern": "- module_name: github.com/f110/(gomodule-proxy\n",
+		"EmptyName":      "- module_name: \"\"\n",
+		"Upstream":       "upstreams:\n  - url: proxy.golang.org\n",
+		"Duration":       "server:\n  read_timeout: 10\n",
+	}
+	for name, v := range cases {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			err := os.WriteFile(filepath.Join(dir, "config.yaml"), []byte(v), 0644)
+			require.NoError(t, err)
+
+			_, err = ReadConfig(filepath.Join(dir, "config.yaml"))
+			assert.Error(t, err)
+		})
+	}
+}
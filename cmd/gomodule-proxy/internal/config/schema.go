@@ -0,0 +1,8 @@
+package config
+
+import _ "embed"
+
+// Schema is JSON Schema of the configuration file.
+//
+//go:embed schema.json
+var Schema []byte
@@ -0,0 +1,287 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+
+	"go.f110.dev/xerrors"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
+)
+
+// forkSuffix is the identifier of the pre-release version.
+var forkSuffix = regexp.MustCompile(`^[0-9A-Za-z-]+$`)
+
+// Validate compiles the patterns of the modules and checks the files which are referred by the config exist.
+func (c *Config) Validate() error {
+	seen := make(map[string]int)
+	for i, v := range c.Modules {
+		if v.ModuleName == "" {
+			return xerrors.Newf("modules[%d]: module_name is required", i)
+		}
+		if j, ok := seen[v.ModuleName]; ok {
+			return xerrors.Newf("modules[%d]: %s is already defined at modules[%d]", i, v.ModuleName, j)
+		}
+		seen[v.ModuleName] = i
+		pattern := v.ModuleName
+		if v.Repository != "" {
+			if strings.ContainsAny(v.ModuleName, `\+*?()|[]{}^$`) {
+				return xerrors.Newf("modules[%d]: module_name has to be the literal import path if repository is specified", i)
+			}
+			if _, err := url.Parse(v.Repository); err != nil {
+				return xerrors.Newf("modules[%d]: %v", i, err)
+			}
+			// The literal import path matches only itself and the packages under it
+			pattern = `^` + regexp.QuoteMeta(v.ModuleName) + `(/|$)`
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return xerrors.Newf("modules[%d]: %v", i, err)
+		}
+		v.match = re
+	}
+	forks := make(map[string]int)
+	for i, v := range c.Forks {
+		if v.Module == "" || v.Repository == "" {
+			return xerrors.Newf("forks[%d]: module and repository are required", i)
+		}
+		if j, ok := forks[v.Module]; ok {
+			return xerrors.Newf("forks[%d]: %s is already defined at forks[%d]", i, v.Module, j)
+		}
+		forks[v.Module] = i
+		if err := module.CheckPath(v.Module); err != nil {
+			return xerrors.Newf("forks[%d]: %v", i, err)
+		}
+		for _, m := range c.Modules {
+			if m.match.MatchString(v.Module) {
+				return xerrors.Newf("forks[%d]: %s is a private module", i, v.Module)
+			}
+		}
+		if _, err := url.Parse(v.Repository); err != nil {
+			return xerrors.Newf("forks[%d]: %v", i, err)
+		}
+		for _, ver := range []string{v.MinVersion, v.MaxVersion} {
+			if ver != "" && semver.Canonical(ver) != ver {
+				return xerrors.Newf("forks[%d]: %s is not a canonical semantic version", i, ver)
+			}
+		}
+		if v.MinVersion != "" && v.MaxVersion != "" && semver.Compare(v.MinVersion, v.MaxVersion) >= 0 {
+			return xerrors.Newf("forks[%d]: min_version has to be less than max_version", i)
+		}
+		if v.Suffix != "" && !forkSuffix.MatchString(v.Suffix) {
+			return xerrors.Newf("forks[%d]: suffix has to consist of alphanumerics and hyphens", i)
+		}
+	}
+	if c.Server != nil && c.Server.PublicURL != "" {
+		u, err := url.Parse(c.Server.PublicURL)
+		if err != nil {
+			return xerrors.Newf("server.public_url: %v", err)
+		}
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return xerrors.Newf("server.public_url: %s is not a URL of HTTP", c.Server.PublicURL)
+		}
+	}
+	if c.Server != nil && c.Server.TLS != nil {
+		if c.Server.TLS.CertFile == "" || c.Server.TLS.KeyFile == "" {
+			return xerrors.New("server.tls: cert_file and key_file are required")
+		}
+		for _, f := range []string{c.Server.TLS.CertFile, c.Server.TLS.KeyFile, c.Server.TLS.ClientCAFile} {
+			if err := fileExists(f); err != nil {
+				return err
+			}
+		}
+	}
+	for i, v := range c.Upstreams {
+		u, err := url.Parse(v.URL)
+		if err != nil {
+			return xerrors.Newf("upstreams[%d]: %v", i, err)
+		}
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return xerrors.Newf("upstreams[%d]: %s is not a URL of HTTP", i, v.URL)
+		}
+	}
+	if c.Quarantine != nil {
+		if c.Quarantine.Duration <= 0 {
+			return xerrors.New("quarantine: duration is required")
+		}
+		c.Quarantine.exclude = nil
+		for i, v := range c.Quarantine.Exclude {
+			re, err := regexp.Compile(v)
+			if err != nil {
+				return xerrors.Newf("quarantine.exclude[%d]: %v", i, err)
+			}
+			c.Quarantine.exclude = append(c.Quarantine.exclude, re)
+		}
+	}
+
+	if c.Admin != nil {
+		if c.Auth == nil {
+			return xerrors.New("admin: the auth section is required")
+		}
+		if len(c.Admin.Users) == 0 && len(c.Admin.Groups) == 0 {
+			return xerrors.New("admin: users or groups are required")
+		}
+	}
+	if c.Webhook != nil && c.Webhook.Secret == "" {
+		return xerrors.New("webhook: secret is required")
+	}
+	if c.Notifications != nil {
+		if c.Storage == nil || c.Storage.IndexFile == "" {
+			return xerrors.New("notifications: storage.index_file is required")
+		}
+		for i, v := range c.Notifications.Targets {
+			re, err := regexp.Compile(v.ModuleName)
+			if err != nil {
+				return xerrors.Newf("notifications.targets[%d]: %v", i, err)
+			}
+			v.match = re
+			u, err := url.Parse(v.URL)
+			if err != nil {
+				return xerrors.Newf("notifications.targets[%d]: %v", i, err)
+			}
+			if u.Scheme != "http" && u.Scheme != "https" {
+				return xerrors.Newf("notifications.targets[%d]: %s is not a URL of HTTP", i, v.URL)
+			}
+		}
+	}
+
+	if c.Auth == nil {
+		return nil
+	}
+	for _, f := range []string{c.Auth.SecretFile, c.Auth.HtpasswdFile} {
+		if err := fileExists(f); err != nil {
+			return err
+		}
+	}
+	for i, v := range c.Auth.OIDC {
+		if v.Issuer == "" {
+			return xerrors.Newf("auth.oidc[%d]: issuer is required", i)
+		}
+		if len(v.Audiences) == 0 {
+			return xerrors.Newf("auth.oidc[%d]: audiences are required", i)
+		}
+		if err := fileExists(v.JWKSFile); err != nil {
+			return err
+		}
+	}
+	for i, v := range c.Auth.Tokens {
+		if v.Name == "" || v.Token == "" {
+			return xerrors.Newf("auth.tokens[%d]: name and token are required", i)
+		}
+	}
+	for i, v := range c.Auth.Users {
+		if v.Name == "" || v.Password == "" {
+			return xerrors.Newf("auth.users[%d]: name and password are required", i)
+		}
+	}
+
+	return nil
+}
+
+// Warnings returns the problems which don't prevent serving but are likely mistakes.
+// The rules are evaluated in order and the first matched rule is used,
+// so the rule which is matched by a preceding rule is shadowed.
+func (c *Config) Warnings() []string {
+	var warnings []string
+	for i, v := range c.Modules {
+		if v.match == nil {
+			continue
+		}
+		for j := 0; j < i; j++ {
+			prev := c.Modules[j]
+			if prev.match == nil {
+				continue
+			}
+			switch {
+			case prev.match.MatchString(examplePath(v.ModuleName)):
+				warnings = append(warnings, fmt.Sprintf("modules[%d] (%s) is shadowed by modules[%d] (%s)", i, v.ModuleName, j, prev.ModuleName))
+			case v.match.MatchString(examplePath(prev.ModuleName)):
+				warnings = append(warnings, fmt.Sprintf("modules[%d] (%s) overlaps with modules[%d] (%s). modules[%d] takes precedence", i, v.ModuleName, j, prev.ModuleName, j))
+			}
+		}
+	}
+
+	return warnings
+}
+
+// examplePath returns the literal part of the pattern as the example of the module path which is matched by the pattern.
+func examplePath(pattern string) string {
+	pattern = strings.TrimPrefix(pattern, "^")
+	var b []byte
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; {
+		case c == '\\' && i+1 < len(pattern):
+			i++
+			b = append(b, pattern[i])
+		case strings.IndexByte(`*?{`, c) != -1:
+			// The preceding character is optional
+			if len(b) > 0 {
+				b = b[:len(b)-1]
+			}
+			return string(b)
+		case strings.IndexByte(`+()|[]}^$`, c) != -1:
+			return string(b)
+		default:
+			b = append(b, c)
+		}
+	}
+
+	return string(b)
+}
+
+func fileExists(path string) error {
+	if path == "" {
+		return nil
+	}
+	if _, err := os.Stat(path); err != nil {
+		return xerrors.WithStack(err)
+	}
+
+	return nil
+}
+
+const redacted = "REDACTED"
+
+// Redacted returns the copy of the config which doesn't have the secrets.
+func (c *Config) Redacted() *Config {
+	conf := *c
+	if c.GitHub != nil && c.GitHub.Token != "" {
+		gh := *c.GitHub
+		gh.Token = redacted
+		conf.GitHub = &gh
+	}
+	if c.Webhook != nil {
+		conf.Webhook = &WebhookConfig{Secret: redacted}
+	}
+	if c.Notifications != nil {
+		n := *c.Notifications
+		n.Targets = nil
+		for _, v := range c.Notifications.Targets {
+			t := *v
+			if t.Secret != "" {
+				t.Secret = redacted
+			}
+			n.Targets = append(n.Targets, &t)
+		}
+		conf.Notifications = &n
+	}
+	if c.Auth == nil {
+		return &conf
+	}
+
+	auth := *c.Auth
+	auth.Tokens = nil
+	for _, v := range c.Auth.Tokens {
+		auth.Tokens = append(auth.Tokens, &TokenCredential{Name: v.Name, Token: redacted})
+	}
+	auth.Users = nil
+	for _, v := range c.Auth.Users {
+		auth.Users = append(auth.Users, &UserCredential{Name: v.Name, Password: redacted})
+	}
+	conf.Auth = &auth
+
+	return &conf
+}
@@ -0,0 +1,133 @@
+package config
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadConfig_Strict(t *testing.T) {
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, "config.yaml"), []byte("modules:\n  - module_name: github.com/f110/gomodule-proxy\n    alowed_users: [alice]\n"), 0644)
+	require.NoError(t, err)
+
+	_, err = ReadConfig(filepath.Join(dir, "config.yaml"))
+	assert.Error(t, err)
+}
+
+func TestConfig_Validate(t *testing.T) {
+	t.Run("Duplicated", func(t *testing.T) {
+		conf := &Config{Modules: []*ModuleSetting{{ModuleName: "example.com/foo"}, {ModuleName: "example.com/foo"}}}
+		assert.Error(t, conf.Validate())
+	})
+
+	t.Run("MissingFile", func(t *testing.T) {
+		conf := &Config{Auth: &AuthConfig{HtpasswdFile: filepath.Join(t.TempDir(), "htpasswd")}}
+		assert.Error(t, conf.Validate())
+	})
+
+	t.Run("OIDCWithoutAudiences", func(t *testing.T) {
+		conf := &Config{Auth: &AuthConfig{OIDC: []*OIDCIssuer{{Issuer: "https://token.actions.githubusercontent.com"}}}}
+		assert.Error(t, conf.Validate())
+		conf.Auth.OIDC[0].Audiences = []string{"gomodule-proxy"}
+		require.NoError(t, conf.Validate())
+	})
+
+	t.Run("AdminWithoutAuth", func(t *testing.T) {
+		conf := &Config{Admin: &AdminConfig{Users: []string{"alice"}}}
+		assert.Error(t, conf.Validate())
+	})
+
+	t.Run("NotificationsWithoutIndex", func(t *testing.T) {
+		conf := &Config{Notifications: &NotificationsConfig{Targets: []*NotificationTarget{{ModuleName: "example.com/", URL: "https://example.com/hook"}}}}
+		assert.Error(t, conf.Validate())
+		conf.Storage = &StorageConfig{IndexFile: "index.jsonl"}
+		require.NoError(t, conf.Validate())
+		assert.NotNil(t, conf.Notifications.Targets[0].Match())
+	})
+
+	t.Run("RepositoryWithPattern", func(t *testing.T) {
+		conf := &Config{Modules: []*ModuleSetting{{ModuleName: `^go\.example\.com/`, Repository: "https://github.com/example/foo"}}}
+		assert.Error(t, conf.Validate())
+		conf.Modules[0].ModuleName = "go.example.com/foo"
+		require.NoError(t, conf.Validate())
+		assert.True(t, conf.Modules[0].Match().MatchString("go.example.com/foo"))
+		assert.True(t, conf.Modules[0].Match().MatchString("go.example.com/foo/pkg/api"))
+		assert.False(t, conf.Modules[0].Match().MatchString("go.example.com/foobar"))
+		assert.False(t, conf.Modules[0].Match().MatchString("evil.com/goXexample.com/foo"))
+	})
+
+	t.Run("Quarantine", func(t *testing.T) {
+		conf := &Config{Quarantine: &QuarantineConfig{Exclude: []string{`^example\.com/`}}}
+		assert.Error(t, conf.Validate())
+		conf.Quarantine.Duration = Duration(72 * time.Hour)
+		require.NoError(t, conf.Validate())
+		assert.Len(t, conf.Quarantine.ExcludeMatches(), 1)
+		// Validate can be called more than once
+		require.NoError(t, conf.Validate())
+		assert.Len(t, conf.Quarantine.ExcludeMatches(), 1)
+	})
+
+	t.Run("Fork", func(t *testing.T) {
+		conf := &Config{
+			Modules: []*ModuleSetting{{ModuleName: `^go\.example\.com/`}},
+			Forks:   []*ForkSetting{{Module: "go.example.com/foo", Repository: "https://github.com/example/foo"}},
+		}
+		assert.Error(t, conf.Validate())
+		conf.Forks[0].Module = "github.com/upstream/foo"
+		conf.Forks[0].MinVersion, conf.Forks[0].MaxVersion = "v1.0.0", "v0.9.0"
+		assert.Error(t, conf.Validate())
+		conf.Forks[0].MinVersion, conf.Forks[0].MaxVersion = "v0.9.0", "v1.0.0"
+		conf.Forks[0].Suffix = "fork.1"
+		assert.Error(t, conf.Validate())
+		conf.Forks[0].Suffix = "patched"
+		require.NoError(t, conf.Validate())
+	})
+
+	t.Run("Valid", func(t *testing.T) {
+		conf := &Config{Modules: []*ModuleSetting{{ModuleName: `^example\.com/foo/`}}}
+		require.NoError(t, conf.Validate())
+		assert.True(t, conf.Modules[0].Match().MatchString("example.com/foo/bar"))
+	})
+}
+
+func TestConfig_Warnings(t *testing.T) {
+	conf := &Config{Modules: []*ModuleSetting{
+		{ModuleName: `^example.com/team-a/`},
+		{ModuleName: `^example\.com/team-a/foo`},
+		{ModuleName: `^example.com/team-b/foo`},
+		{ModuleName: `^example.com/team-b/.*`},
+		{ModuleName: `^example.com/team-c/`},
+	}}
+	require.NoError(t, conf.Validate())
+
+	warnings := conf.Warnings()
+	require.Len(t, warnings, 2)
+	assert.Contains(t, warnings[0], "modules[1]")
+	assert.Contains(t, warnings[0], "shadowed by modules[0]")
+	assert.Contains(t, warnings[1], "modules[3]")
+	assert.Contains(t, warnings[1], "overlaps with modules[2]")
+}
+
+func TestConfig_Redacted(t *testing.T) {
+	conf := &Config{Auth: &AuthConfig{Credentials: Credentials{
+		Tokens: []*TokenCredential{{Name: "ci", Token: "foobar"}},
+		Users:  []*UserCredential{{Name: "alice", Password: "{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g="}},
+	}}}
+
+	r := conf.Redacted()
+	assert.Equal(t, "ci", r.Auth.Tokens[0].Name)
+	assert.Equal(t, redacted, r.Auth.Tokens[0].Token)
+	assert.Equal(t, redacted, r.Auth.Users[0].Password)
+	assert.Equal(t, "foobar", conf.Auth.Tokens[0].Token)
+}
+
+func TestSchema(t *testing.T) {
+	var v map[string]interface{}
+	require.NoError(t, json.Unmarshal(Schema, &v))
+}
@@ -23,6 +23,7 @@ func goModuleProxy() error {
 		},
 	}
 	proxy.Flags(cmd.Flags())
+	cmd.AddCommand(newConfigCommand(), newWarmCommand(), newExportCommand(), newImportCommand(), newMirrorCommand())
 	for _, v := range proxy.RequiredFlags() {
 		if err := cmd.MarkFlagRequired(v); err != nil {
 			return err
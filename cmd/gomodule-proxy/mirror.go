@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"go.f110.dev/xerrors"
+
+	"go.f110.dev/gomodule-proxy/cmd/gomodule-proxy/internal/config"
+	"go.f110.dev/gomodule-proxy/internal/gomodule"
+)
+
+func newMirrorCommand() *cobra.Command {
+	var configPath, moduleDir, output string
+
+	cmd := &cobra.Command{
+		Use:   "mirror [module...]",
+		Short: "Write the private modules into the directory in GOPROXY layout",
+		Long: `Write all versions of the private modules into the directory in GOPROXY layout.
+The directory can be published by a static file server or used as GOPROXY=file:///path/to/dir.
+If no module is given, the modules which are configured literally are mirrored.
+The versions which have already been mirrored are skipped.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if configPath == "" || output == "" {
+				return xerrors.New("--config and --output are required")
+			}
+			conf, err := config.ReadConfig(configPath)
+			if err != nil {
+				return err
+			}
+			if !cmd.Flags().Changed("mod-dir") && conf.Storage != nil && conf.Storage.ModuleDir != "" {
+				moduleDir = conf.Storage.ModuleDir
+			}
+
+			proxy := gomodule.NewModuleProxy(moduleRules(conf), moduleDir, cliRefreshInterval, nil, nil, nil)
+			modules := args
+			if len(modules) == 0 {
+				modules = proxy.ConfiguredModules()
+			}
+			out := gomodule.NewArtifactCache(output)
+			for _, v := range modules {
+				if !proxy.IsProxy(v) {
+					return xerrors.Newf("%s is not a private module", v)
+				}
+				res, err := gomodule.Mirror(cmd.Context(), proxy, out, v)
+				if err != nil {
+					return err
+				}
+				for _, ver := range res.Added {
+					fmt.Fprintf(cmd.OutOrStdout(), "%s@%s\n", res.Module, ver)
+				}
+				fmt.Fprintf(cmd.ErrOrStderr(), "%s: %d new versions (latest: %s)\n", res.Module, len(res.Added), res.Latest)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVarP(&configPath, "config", "c", configPath, "Configuration file path")
+	cmd.Flags().StringVar(&moduleDir, "mod-dir", moduleDir, "Module directory")
+	cmd.Flags().StringVarP(&output, "output", "o", output, "Directory which the modules are written to")
+
+	return cmd
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/go-logr/logr"
+	"go.f110.dev/xerrors"
+
+	"go.f110.dev/gomodule-proxy/cmd/gomodule-proxy/internal/config"
+	"go.f110.dev/gomodule-proxy/internal/gomodule"
+)
+
+// configReloader reads the configuration file again on SIGHUP or when the file is modified,
+// and replaces the module rules of ModuleProxy.
+// The other sections (e.g. auth) are not reloaded. They require restarting the proxy.
+type configReloader struct {
+	path     string
+	interval time.Duration
+	proxy    *gomodule.ModuleProxy
+	logger   logr.Logger
+
+	modTime time.Time
+}
+
+func newConfigReloader(path string, interval time.Duration, proxy *gomodule.ModuleProxy, logger logr.Logger) *configReloader {
+	r := &configReloader{path: path, interval: interval, proxy: proxy, logger: logger}
+	if fi, err := os.Stat(path); err == nil {
+		r.modTime = fi.ModTime()
+	}
+
+	return r
+}
+
+// Run watches SIGHUP and the modification of the file until ctx is canceled.
+// If interval is zero, the file is not watched.
+func (r *configReloader) Run(ctx context.Context) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	var tick <-chan time.Time
+	if r.interval > 0 {
+		t := time.NewTicker(r.interval)
+		defer t.Stop()
+		tick = t.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			r.logger.Info("Received SIGHUP. Reloading the configuration", "path", r.path)
+			r.reload()
+		case <-tick:
+			fi, err := os.Stat(r.path)
+			if err != nil {
+				r.logger.Info("Failed to stat the configuration file", "path", r.path, xerrors.ZapField(err))
+				continue
+			}
+			if fi.ModTime().Equal(r.modTime) {
+				continue
+			}
+			r.modTime = fi.ModTime()
+			r.logger.Info("The configuration file is modified. Reloading", "path", r.path)
+			r.reload()
+		}
+	}
+}
+
+func (r *configReloader) reload() {
+	if err := r.Reload(); err != nil {
+		r.logger.Info("Rejected the new configuration. Keep the current one", xerrors.ZapField(err))
+	}
+}
+
+// Reload reads and validates the configuration, and then swaps the module rules and the fork rules.
+// If the configuration is invalid, the current rules are kept.
+func (r *configReloader) Reload() error {
+	conf, err := config.ReadConfig(r.path)
+	if err != nil {
+		return err
+	}
+
+	modules, forks := moduleRules(conf), forkRules(conf)
+	diff := r.proxy.SetConfig(modules, forks)
+	if diff.IsEmpty() {
+		r.logger.Info("Configuration reloaded. The module rules are not changed")
+		return nil
+	}
+	r.logger.Info("Configuration reloaded", "added", diff.Added, "removed", diff.Removed, "changed", diff.Changed)
+	return nil
+}
+
+func moduleRules(conf *config.Config) []*gomodule.ModuleRule {
+	var modules []*gomodule.ModuleRule
+	for _, v := range conf.Modules {
+		modules = append(modules, &gomodule.ModuleRule{
+			Match:         v.Match(),
+			AllowedUsers:  v.AllowedUsers,
+			AllowedGroups: v.AllowedGroups,
+			Repository:    v.Repository,
+			Prefix:        vanityPrefix(v),
+		})
+	}
+
+	return modules
+}
+
+// vanityPrefix returns the literal import path of the module which is served from the repository.
+func vanityPrefix(v *config.ModuleSetting) string {
+	if v.Repository == "" {
+		return ""
+	}
+	return v.ModuleName
+}
+
+func forkRules(conf *config.Config) []*gomodule.ForkRule {
+	var forks []*gomodule.ForkRule
+	for _, v := range conf.Forks {
+		forks = append(forks, &gomodule.ForkRule{
+			Module:     v.Module,
+			Repository: v.Repository,
+			MinVersion: v.MinVersion,
+			MaxVersion: v.MaxVersion,
+			Suffix:     v.Suffix,
+		})
+	}
+
+	return forks
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"io"
+	"os"
+
+	"go.f110.dev/xerrors"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.34.0"
+)
+
+const (
+	traceExporterNone   = "none"
+	traceExporterOTLP   = "otlp"
+	traceExporterStdout = "stdout"
+	traceExporterFile   = "file"
+)
+
+// setupTracerProvider configures the global TracerProvider and the propagator.
+// The endpoint of OTLP exporter can be configured by the standard environment variables (e.g. OTEL_EXPORTER_OTLP_ENDPOINT) too.
+func setupTracerProvider(ctx context.Context, exporter, otlpEndpoint, filePath string, sampleRatio float64) (*sdktrace.TracerProvider, error) {
+	var spanExporter sdktrace.SpanExporter
+	switch exporter {
+	case "", traceExporterNone:
+		return nil, nil
+	case traceExporterOTLP:
+		var opts []otlptracehttp.Option
+		if otlpEndpoint != "" {
+			opts = append(opts, otlptracehttp.WithEndpointURL(otlpEndpoint))
+		}
+		e, err := otlptracehttp.New(ctx, opts...)
+		if err != nil {
+			return nil, xerrors.WithStack(err)
+		}
+		spanExporter = e
+	case traceExporterStdout, traceExporterFile:
+		var w io.Writer = os.Stdout
+		if exporter == traceExporterFile {
+			if filePath == "" {
+				return nil, xerrors.New("--trace-file is required for the file exporter")
+			}
+			f, err := os.OpenFile(filePath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+			if err != nil {
+				return nil, xerrors.WithStack(err)
+			}
+			w = f
+		}
+		e, err := stdouttrace.New(stdouttrace.WithWriter(w))
+		if err != nil {
+			return nil, xerrors.WithStack(err)
+		}
+		spanExporter = e
+	default:
+		return nil, xerrors.Newf("unknown trace exporter: %s", exporter)
+	}
+
+	res, err := resource.Merge(
+		resource.Default(),
+		resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName("gomodule-proxy")),
+	)
+	if err != nil {
+		return nil, xerrors.WithStack(err)
+	}
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(spanExporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(sampleRatio))),
+	)
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	return tp, nil
+}
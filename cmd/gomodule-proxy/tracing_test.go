@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+func TestSetupTracerProvider(t *testing.T) {
+	tp, err := setupTracerProvider(context.Background(), traceExporterNone, "", "", 1)
+	require.NoError(t, err)
+	assert.Nil(t, tp)
+
+	_, err = setupTracerProvider(context.Background(), "unknown", "", "", 1)
+	assert.Error(t, err)
+	_, err = setupTracerProvider(context.Background(), traceExporterFile, "", "", 1)
+	assert.Error(t, err)
+
+	traceFile := filepath.Join(t.TempDir(), "trace.json")
+	tp, err = setupTracerProvider(context.Background(), traceExporterFile, "", traceFile, 1)
+	require.NoError(t, err)
+
+	// The trace context of the incoming request is extracted by the global propagator
+	carrier := propagation.HeaderCarrier{}
+	carrier.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	ctx := otel.GetTextMapPropagator().Extract(context.Background(), carrier)
+	_, span := otel.Tracer("test").Start(ctx, "test-span")
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", span.SpanContext().TraceID().String())
+	span.End()
+	require.NoError(t, tp.Shutdown(context.Background()))
+
+	buf, err := os.ReadFile(traceFile)
+	require.NoError(t, err)
+	assert.Contains(t, string(buf), `"Name":"test-span"`)
+	assert.Contains(t, string(buf), "gomodule-proxy")
+
+	// The span whose parent is not sampled is not recorded
+	tp, err = setupTracerProvider(context.Background(), traceExporterFile, "", traceFile, 1)
+	require.NoError(t, err)
+	carrier.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+	ctx = otel.GetTextMapPropagator().Extract(context.Background(), carrier)
+	_, span = otel.Tracer("test").Start(ctx, "not-sampled")
+	assert.False(t, span.SpanContext().IsSampled())
+	span.End()
+	require.NoError(t, tp.Shutdown(context.Background()))
+	buf, err = os.ReadFile(traceFile)
+	require.NoError(t, err)
+	assert.NotContains(t, string(buf), "not-sampled")
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+	"go.f110.dev/xerrors"
+	"golang.org/x/mod/module"
+
+	"go.f110.dev/gomodule-proxy/cmd/gomodule-proxy/internal/config"
+	"go.f110.dev/gomodule-proxy/internal/gomodule"
+)
+
+// cliRefreshInterval is the refresh interval of the repository for the subcommands.
+// The repository is fetched once in a run.
+const cliRefreshInterval = time.Hour
+
+func newWarmCommand() *cobra.Command {
+	var configPath, moduleDir, cacheDir, file string
+	concurrency := 4
+
+	cmd := &cobra.Command{
+		Use:   "warm [module@version...]",
+		Short: "Populate the clone and artifact caches",
+		Long: `Populate the clone and artifact caches of the private modules.
+The modules are given by the arguments or the file (-f). The file is a list of module@version, go.mod, go.sum or go.work.
+If the version is omitted, the latest version is warmed. The modules which are not private are skipped.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if configPath == "" {
+				return xerrors.New("--config is required")
+			}
+			conf, err := config.ReadConfig(configPath)
+			if err != nil {
+				return err
+			}
+			if conf.Storage != nil {
+				if !cmd.Flags().Changed("mod-dir") && conf.Storage.ModuleDir != "" {
+					moduleDir = conf.Storage.ModuleDir
+				}
+				if !cmd.Flags().Changed("cache-dir") && conf.Storage.CacheDir != "" {
+					cacheDir = conf.Storage.CacheDir
+				}
+			}
+
+			var mods []module.Version
+			for _, v := range args {
+				mods = append(mods, gomodule.ParseModuleVersion(v))
+			}
+			if file != "" {
+				m, err := gomodule.ReadModuleList(file)
+				if err != nil {
+					return err
+				}
+				mods = append(mods, m...)
+			}
+			if len(mods) == 0 {
+				return xerrors.New("no module is given")
+			}
+
+			proxy := gomodule.NewModuleProxy(moduleRules(conf), moduleDir, cliRefreshInterval, newArtifactCache(cacheDir), nil, nil)
+			var private []module.Version
+			for _, v := range mods {
+				if proxy.IsProxy(v.Path) {
+					private = append(private, v)
+				}
+			}
+			fmt.Fprintf(cmd.ErrOrStderr(), "Warming %d modules (%d modules are skipped)\n", len(private), len(mods)-len(private))
+
+			var mu sync.Mutex
+			failed := 0
+			proxy.WarmModules(cmd.Context(), private, concurrency, func(mod module.Version, err error) {
+				mu.Lock()
+				defer mu.Unlock()
+
+				if err != nil {
+					failed++
+					fmt.Fprintf(cmd.ErrOrStderr(), "%s: %v\n", moduleVersionString(mod), err)
+					return
+				}
+				fmt.Fprintln(cmd.OutOrStdout(), moduleVersionString(mod))
+			})
+			if failed > 0 {
+				return xerrors.Newf("failed to warm %d modules", failed)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVarP(&configPath, "config", "c", configPath, "Configuration file path")
+	cmd.Flags().StringVar(&moduleDir, "mod-dir", moduleDir, "Module directory")
+	cmd.Flags().StringVar(&cacheDir, "cache-dir", cacheDir, "Directory which the artifacts of the modules are stored into")
+	cmd.Flags().StringVarP(&file, "file", "f", file, "File of the modules (list of module@version, go.mod, go.sum or go.work)")
+	cmd.Flags().IntVar(&concurrency, "concurrency", concurrency, "The number of the modules which are warmed concurrently")
+
+	return cmd
+}
+
+func newArtifactCache(dir string) *gomodule.ArtifactCache {
+	if dir == "" {
+		return nil
+	}
+
+	return gomodule.NewArtifactCache(dir)
+}
+
+func moduleVersionString(mod module.Version) string {
+	if mod.Version == "" {
+		return mod.Path + "@latest"
+	}
+	return mod.String()
+}
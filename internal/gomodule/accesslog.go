@@ -0,0 +1,200 @@
+package gomodule
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"go.f110.dev/xerrors"
+)
+
+const requestIDHeader = "X-Request-Id"
+
+// requestIDPattern is the request ID which is accepted from the client. The other ID is replaced with the generated one
+// so that the client can not inject an arbitrary string into the logs and the upstream.
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+type AccessLogFormat string
+
+const (
+	// AccessLogFormatLogger writes the access log through the application logger.
+	AccessLogFormatLogger AccessLogFormat = "logger"
+	// AccessLogFormatJSON writes the access log as newline-delimited JSON.
+	AccessLogFormatJSON AccessLogFormat = "json"
+	// AccessLogFormatCombined writes the access log in Apache combined log format.
+	// The request ID, the route, the module and the version are appended to the line.
+	AccessLogFormatCombined AccessLogFormat = "combined"
+)
+
+func ParseAccessLogFormat(s string) (AccessLogFormat, error) {
+	switch f := AccessLogFormat(s); f {
+	case "", AccessLogFormatLogger:
+		return AccessLogFormatLogger, nil
+	case AccessLogFormatJSON, AccessLogFormatCombined:
+		return f, nil
+	default:
+		return "", xerrors.Newf("unknown access log format: %s", s)
+	}
+}
+
+// requestInfo is the information about the request which is resolved by the handler.
+// The handler fills the fields and the access log middleware reads them after the handler returns.
+type requestInfo struct {
+	ID      string
+	User    string
+	Route   string
+	Module  string
+	Version string
+}
+
+type requestInfoKey struct{}
+
+func withRequestInfo(ctx context.Context, info *requestInfo) context.Context {
+	return context.WithValue(ctx, requestInfoKey{}, info)
+}
+
+// requestInfoFromContext returns the requestInfo of the request.
+// It never returns nil so that the handlers can set the fields unconditionally.
+func requestInfoFromContext(ctx context.Context) *requestInfo {
+	if v, ok := ctx.Value(requestInfoKey{}).(*requestInfo); ok {
+		return v
+	}
+	return &requestInfo{}
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
+
+type accessLogEntry struct {
+	Time       time.Time `json:"time"`
+	RequestID  string    `json:"request_id"`
+	RemoteAddr string    `json:"remote_addr"`
+	User       string    `json:"user,omitempty"`
+	Host       string    `json:"host"`
+	Method     string    `json:"method"`
+	Path       string    `json:"path"`
+	Protocol   string    `json:"protocol"`
+	Status     int       `json:"status"`
+	Size       int64     `json:"size"`
+	Duration   float64   `json:"duration"`
+	Referer    string    `json:"referer,omitempty"`
+	UserAgent  string    `json:"ua"`
+	Route      string    `json:"route,omitempty"`
+	Module     string    `json:"module,omitempty"`
+	Version    string    `json:"version,omitempty"`
+}
+
+func middlewareAccessLog(logger logr.Logger, format AccessLogFormat, out io.Writer) func(next http.Handler) http.Handler {
+	var mu sync.Mutex
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			info := &requestInfo{ID: req.Header.Get(requestIDHeader)}
+			if !requestIDPattern.MatchString(info.ID) {
+				info.ID = newRequestID()
+				// Propagate the generated ID to the upstream
+				req.Header.Set(requestIDHeader, info.ID)
+			}
+			w.Header().Set(requestIDHeader, info.ID)
+
+			rw := newResponseWriter(w)
+			t1 := time.Now()
+			next.ServeHTTP(rw, req.WithContext(withRequestInfo(req.Context(), info)))
+
+			entry := &accessLogEntry{
+				Time:       t1,
+				RequestID:  info.ID,
+				RemoteAddr: req.RemoteAddr,
+				User:       info.User,
+				Host:       req.Host,
+				Method:     req.Method,
+				Path:       req.URL.Path,
+				Protocol:   req.Proto,
+				Status:     rw.status,
+				Size:       rw.written,
+				Duration:   time.Since(t1).Seconds(),
+				Referer:    req.Referer(),
+				UserAgent:  req.UserAgent(),
+				Route:      info.Route,
+				Module:     info.Module,
+				Version:    info.Version,
+			}
+			switch format {
+			case AccessLogFormatJSON:
+				buf, err := json.Marshal(entry)
+				if err != nil {
+					logger.Error(err, "Failed to encode the access log")
+					return
+				}
+				mu.Lock()
+				out.Write(append(buf, '\n'))
+				mu.Unlock()
+			case AccessLogFormatCombined:
+				line := combinedLogLine(entry)
+				mu.Lock()
+				io.WriteString(out, line)
+				mu.Unlock()
+			default:
+				logger.Info(
+					"",
+					"request_id", entry.RequestID,
+					"host", entry.Host,
+					"protocol", entry.Protocol,
+					"method", entry.Method,
+					"path", entry.Path,
+					"remote_addr", entry.RemoteAddr,
+					"user", entry.User,
+					"ua", entry.UserAgent,
+					"status", entry.Status,
+					"size", entry.Size,
+					"duration", entry.Duration,
+					"route", entry.Route,
+					"module", entry.Module,
+					"version", entry.Version,
+				)
+			}
+		})
+	}
+}
+
+func combinedLogLine(e *accessLogEntry) string {
+	host, _, err := net.SplitHostPort(e.RemoteAddr)
+	if err != nil {
+		host = e.RemoteAddr
+	}
+
+	return fmt.Sprintf("%s - %s [%s] %q %d %d %q %q %q %s %s %s\n",
+		host,
+		dashIfEmpty(e.User),
+		e.Time.Format("02/Jan/2006:15:04:05 -0700"),
+		e.Method+" "+e.Path+" "+e.Protocol,
+		e.Status,
+		e.Size,
+		dashIfEmpty(e.Referer),
+		e.UserAgent,
+		e.RequestID,
+		dashIfEmpty(e.Route),
+		dashIfEmpty(e.Module),
+		dashIfEmpty(e.Version),
+	)
+}
+
+func dashIfEmpty(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
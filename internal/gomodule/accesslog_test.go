@@ -0,0 +1,91 @@
+package gomodule
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/go-logr/logr/funcr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMiddlewareAccessLog(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		info := requestInfoFromContext(req.Context())
+		info.Route = routePrivate
+		info.Module = "example.com/foo"
+		info.Version = "v1.0.0"
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("not found"))
+	})
+
+	t.Run("JSON", func(t *testing.T) {
+		buf := new(bytes.Buffer)
+		h := middlewareAccessLog(logr.Discard(), AccessLogFormatJSON, buf)(handler)
+		req := httptest.NewRequest(http.MethodGet, "/example.com/foo/@v/v1.0.0.info", nil)
+		req.Header.Set(requestIDHeader, "test-id")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+
+		assert.Equal(t, "test-id", rec.Header().Get(requestIDHeader))
+		var entry accessLogEntry
+		require.NoError(t, json.Unmarshal(buf.Bytes(), &entry))
+		assert.Equal(t, "test-id", entry.RequestID)
+		assert.Equal(t, http.StatusNotFound, entry.Status)
+		assert.Equal(t, int64(9), entry.Size)
+		assert.Equal(t, routePrivate, entry.Route)
+		assert.Equal(t, "example.com/foo", entry.Module)
+		assert.Equal(t, "v1.0.0", entry.Version)
+	})
+
+	t.Run("Combined", func(t *testing.T) {
+		buf := new(bytes.Buffer)
+		h := middlewareAccessLog(logr.Discard(), AccessLogFormatCombined, buf)(handler)
+		req := httptest.NewRequest(http.MethodGet, "/example.com/foo/@v/v1.0.0.info", nil)
+		req.Header.Set("User-Agent", "Go-http-client/1.1")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+
+		assert.NotEmpty(t, rec.Header().Get(requestIDHeader))
+		assert.Regexp(t, `^192\.0\.2\.1 - - \[.+\] "GET /example.com/foo/@v/v1.0.0.info HTTP/1.1" 404 9 "-" "Go-http-client/1.1" "`+rec.Header().Get(requestIDHeader)+`" private example.com/foo v1.0.0\n$`, buf.String())
+	})
+
+	t.Run("InvalidRequestID", func(t *testing.T) {
+		buf := new(bytes.Buffer)
+		var received string
+		h := middlewareAccessLog(logr.Discard(), AccessLogFormatJSON, buf)(http.HandlerFunc(func(_ http.ResponseWriter, req *http.Request) {
+			received = req.Header.Get(requestIDHeader)
+		}))
+		req := httptest.NewRequest(http.MethodGet, "/example.com/foo/@v/list", nil)
+		req.Header.Set(requestIDHeader, "foo\" injected=\"bar")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+
+		var entry accessLogEntry
+		require.NoError(t, json.Unmarshal(buf.Bytes(), &entry))
+		assert.Regexp(t, `^[0-9a-f]{32}$`, entry.RequestID)
+		assert.Equal(t, entry.RequestID, rec.Header().Get(requestIDHeader))
+		// The upstream receives the generated ID
+		assert.Equal(t, entry.RequestID, received)
+	})
+}
+
+func TestProxyServer_AccessLog(t *testing.T) {
+	var logs []string
+	logger := funcr.New(func(_, args string) { logs = append(logs, args) }, funcr.Options{})
+	proxy := NewModuleProxy(nil, t.TempDir(), 0, nil, nil, nil)
+	s := NewProxyServer("", nil, ServerTimeouts{}, []*url.URL{newTestUpstream(t, nil)}, proxy, nil, nil, nil, AccessLogFormatLogger, logger, false)
+
+	// The request which doesn't match any route is logged
+	rec := httptest.NewRecorder()
+	s.s.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/.env", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	require.Len(t, logs, 1)
+	assert.Contains(t, logs[0], `"path"="/.env"`)
+	assert.Contains(t, logs[0], `"status"=404`)
+}
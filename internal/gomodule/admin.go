@@ -0,0 +1,176 @@
+package gomodule
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-logr/logr"
+	"github.com/gorilla/mux"
+	"go.f110.dev/xerrors"
+)
+
+// AdminHandler is the API for the operators.
+//
+//	GET    /_admin/repositories                    lists the repositories which have been fetched
+//	POST   /_admin/repositories/{repo}/refresh     fetches the repository from the remote
+//	POST   /_admin/repositories/{repo}/rediscover  finds the modules and the versions in the local clone again
+//	DELETE /_admin/cache?module=...&version=...    purges the cached artifacts. If version is omitted, all versions are purged
+//
+// The client is authenticated by Authenticator and has to be one of the admin users or groups.
+type AdminHandler struct {
+	proxy  *ModuleProxy
+	auth   *Authenticator
+	admins AccessList
+	logger logr.Logger
+}
+
+// AccessList is the list of the users and the groups which are allowed to access.
+// Unlike ModuleRule, the empty list doesn't allow anyone.
+type AccessList struct {
+	Users  []string
+	Groups []string
+}
+
+// Contains returns true if the client is one of the users or belongs to one of the groups.
+func (l AccessList) Contains(id *Identity) bool {
+	if id == nil {
+		return false
+	}
+
+	for _, v := range l.Users {
+		if v == id.Name {
+			return true
+		}
+	}
+	for _, v := range l.Groups {
+		for _, g := range id.Groups {
+			if v == g {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func NewAdminHandler(proxy *ModuleProxy, auth *Authenticator, users, groups []string, logger logr.Logger) (*AdminHandler, error) {
+	if auth == nil {
+		return nil, xerrors.New("the admin API requires the authentication of the clients")
+	}
+	if len(users) == 0 && len(groups) == 0 {
+		return nil, xerrors.New("at least one admin user or group is required")
+	}
+
+	return &AdminHandler{
+		proxy:  proxy,
+		auth:   auth,
+		admins: AccessList{Users: users, Groups: groups},
+		logger: logger,
+	}, nil
+}
+
+func (h *AdminHandler) Handler() http.Handler {
+	r := mux.NewRouter()
+	r.Methods(http.MethodGet).Path("/_admin/repositories").HandlerFunc(h.repositories)
+	r.Methods(http.MethodPost).Path("/_admin/repositories/{repo:.+}/refresh").HandlerFunc(h.refresh)
+	r.Methods(http.MethodPost).Path("/_admin/repositories/{repo:.+}/rediscover").HandlerFunc(h.rediscover)
+	r.Methods(http.MethodDelete).Path("/_admin/cache").HandlerFunc(h.purge)
+	r.Use(h.middlewareAuth)
+
+	return r
+}
+
+func (h *AdminHandler) middlewareAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		id, err := h.auth.Authenticate(req)
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", `Basic realm="gomodule-proxy"`)
+			writeJSONError(w, http.StatusUnauthorized, ErrUnauthorized)
+			return
+		}
+		if !h.admins.Contains(id) {
+			h.logger.Info("Access denied", "user", id.Name, "method", req.Method, "path", req.URL.Path)
+			writeJSONError(w, http.StatusForbidden, xerrors.New("forbidden"))
+			return
+		}
+		requestInfoFromContext(req.Context()).User = id.Name
+
+		next.ServeHTTP(w, req.WithContext(withIdentity(req.Context(), id)))
+	})
+}
+
+func (h *AdminHandler) repositories(w http.ResponseWriter, _ *http.Request) {
+	repos := h.proxy.Repositories()
+	if repos == nil {
+		repos = []RepositoryStatus{}
+	}
+	writeJSON(w, http.StatusOK, repos)
+}
+
+func (h *AdminHandler) refresh(w http.ResponseWriter, req *http.Request) {
+	repo := mux.Vars(req)["repo"]
+	if !h.proxy.IsProxy(repo) {
+		writeJSONError(w, http.StatusNotFound, xerrors.Newf("%s is not a private module", repo))
+		return
+	}
+
+	h.audit(req, "Refresh the repository", "repository", repo)
+	if err := h.proxy.Refresh(req.Context(), repo); err != nil {
+		writeJSONError(w, http.StatusBadGateway, err)
+		return
+	}
+	h.writeRepository(w, repo)
+}
+
+func (h *AdminHandler) rediscover(w http.ResponseWriter, req *http.Request) {
+	repo := mux.Vars(req)["repo"]
+	h.audit(req, "Rediscover the repository", "repository", repo)
+	if err := h.proxy.Rediscover(req.Context(), repo); err != nil {
+		writeJSONError(w, http.StatusNotFound, err)
+		return
+	}
+	h.writeRepository(w, repo)
+}
+
+func (h *AdminHandler) purge(w http.ResponseWriter, req *http.Request) {
+	mod, version := req.URL.Query().Get("module"), req.URL.Query().Get("version")
+	if mod == "" {
+		writeJSONError(w, http.StatusBadRequest, xerrors.New("module is required"))
+		return
+	}
+
+	h.audit(req, "Purge the cache", "module", mod, "version", version)
+	if err := h.proxy.PurgeCache(mod, version); err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *AdminHandler) writeRepository(w http.ResponseWriter, repo string) {
+	for _, v := range h.proxy.Repositories() {
+		if v.Root == repo {
+			writeJSON(w, http.StatusOK, v)
+			return
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *AdminHandler) audit(req *http.Request, msg string, keysAndValues ...interface{}) {
+	var user string
+	if id := IdentityFromContext(req.Context()); id != nil {
+		user = id.Name
+	}
+	h.logger.Info(msg, append([]interface{}{"user", user, "request_id", requestInfoFromContext(req.Context()).ID}, keysAndValues...)...)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeJSONError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
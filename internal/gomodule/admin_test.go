@@ -0,0 +1,78 @@
+package gomodule
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdminHandler(t *testing.T) {
+	auth, err := NewAuthenticator(
+		[]BearerToken{{Name: "alice", Token: "admin-token"}, {Name: "bob", Token: "user-token"}},
+		nil,
+		nil,
+		nil,
+		false,
+	)
+	require.NoError(t, err)
+	cache := NewArtifactCache(t.TempDir())
+	proxy := NewModuleProxy([]*ModuleRule{{Match: regexp.MustCompile(`^github.com/f110/`)}}, t.TempDir(), 0, cache, nil, nil)
+	h, err := NewAdminHandler(proxy, auth, []string{"alice"}, nil, logr.Discard())
+	require.NoError(t, err)
+	handler := h.Handler()
+
+	send := func(method, path, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := send(http.MethodGet, "/_admin/repositories", "")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.NotEmpty(t, rec.Header().Get("WWW-Authenticate"))
+	assert.Equal(t, http.StatusForbidden, send(http.MethodGet, "/_admin/repositories", "user-token").Code)
+
+	rec = send(http.MethodGet, "/_admin/repositories", "admin-token")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var repos []RepositoryStatus
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&repos))
+	assert.Empty(t, repos)
+
+	assert.Equal(t, http.StatusNotFound, send(http.MethodPost, "/_admin/repositories/github.com/golang/go/refresh", "admin-token").Code)
+	assert.Equal(t, http.StatusNotFound, send(http.MethodPost, "/_admin/repositories/github.com/f110/unknown/rediscover", "admin-token").Code)
+
+	err = cache.Put("github.com/f110/foo", "v1.0.0", ArtifactMod, func(w io.Writer) error {
+		_, err := io.WriteString(w, "module github.com/f110/foo\n")
+		return err
+	})
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, send(http.MethodDelete, "/_admin/cache", "admin-token").Code)
+	assert.Equal(t, http.StatusNoContent, send(http.MethodDelete, "/_admin/cache?module=github.com/f110/foo&version=v1.0.0", "admin-token").Code)
+	assert.False(t, cache.Has("github.com/f110/foo", "v1.0.0", ArtifactMod))
+
+	_, err = NewAdminHandler(proxy, nil, []string{"alice"}, nil, logr.Discard())
+	assert.Error(t, err)
+	_, err = NewAdminHandler(proxy, auth, nil, nil, logr.Discard())
+	assert.Error(t, err)
+}
+
+func TestAccessList(t *testing.T) {
+	l := AccessList{Users: []string{"alice"}, Groups: []string{"admins"}}
+	assert.True(t, l.Contains(&Identity{Name: "alice"}))
+	assert.True(t, l.Contains(&Identity{Name: "bob", Groups: []string{"developers", "admins"}}))
+	assert.False(t, l.Contains(&Identity{Name: "bob", Groups: []string{"developers"}}))
+	assert.False(t, l.Contains(nil))
+	// The empty list doesn't allow anyone
+	assert.False(t, AccessList{}.Contains(&Identity{Name: "alice"}))
+}
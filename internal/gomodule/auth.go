@@ -0,0 +1,229 @@
+package gomodule
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+
+	"go.f110.dev/xerrors"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	ErrUnauthorized       = xerrors.New("unauthorized")
+	ErrInvalidCredentials = xerrors.New("invalid credentials")
+)
+
+// Identity is the authenticated client.
+type Identity struct {
+	Name   string
+	Groups []string
+}
+
+type identityKey struct{}
+
+func withIdentity(ctx context.Context, id *Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, id)
+}
+
+// IdentityFromContext returns the authenticated client of the request.
+// It returns nil if the request is not authenticated.
+func IdentityFromContext(ctx context.Context) *Identity {
+	if v, ok := ctx.Value(identityKey{}).(*Identity); ok {
+		return v
+	}
+	return nil
+}
+
+type BearerToken struct {
+	Name  string
+	Token string
+}
+
+type BasicUser struct {
+	Name string
+	// PasswordHash is a hashed password in the htpasswd format.
+	// bcrypt ($2y$, $2a$ and $2b$) and SHA1 ({SHA}) are supported.
+	PasswordHash string
+}
+
+type Authenticator struct {
+	tokens            map[[sha256.Size]byte]*Identity
+	users             map[string]*basicUser
+	memberOf          map[string][]string
+	jwtVerifier       *JWTVerifier
+	anonymousUpstream bool
+}
+
+type basicUser struct {
+	Identity     *Identity
+	PasswordHash string
+}
+
+// NewAuthenticator returns the Authenticator.
+// groups is the map of the group name to the names of the members.
+// jwtVerifier is optional. If it is not nil, the bearer token which is not a static token is verified as JWT.
+func NewAuthenticator(tokens []BearerToken, users []BasicUser, groups map[string][]string, jwtVerifier *JWTVerifier, anonymousUpstream bool) (*Authenticator, error) {
+	memberOf := make(map[string][]string)
+	for name, members := range groups {
+		for _, v := range members {
+			memberOf[v] = append(memberOf[v], name)
+		}
+	}
+	for _, v := range memberOf {
+		sort.Strings(v)
+	}
+
+	a := &Authenticator{
+		tokens:            make(map[[sha256.Size]byte]*Identity),
+		users:             make(map[string]*basicUser),
+		memberOf:          memberOf,
+		jwtVerifier:       jwtVerifier,
+		anonymousUpstream: anonymousUpstream,
+	}
+	for _, v := range tokens {
+		if v.Token == "" {
+			return nil, xerrors.Newf("token of %s is empty", v.Name)
+		}
+		a.tokens[sha256.Sum256([]byte(v.Token))] = &Identity{Name: v.Name, Groups: memberOf[v.Name]}
+	}
+	for _, v := range users {
+		if !isSupportedPasswordHash(v.PasswordHash) {
+			return nil, xerrors.Newf("password hash of %s is not supported. Use bcrypt or SHA1", v.Name)
+		}
+		a.users[v.Name] = &basicUser{Identity: &Identity{Name: v.Name, Groups: memberOf[v.Name]}, PasswordHash: v.PasswordHash}
+	}
+
+	return a, nil
+}
+
+// Authenticate returns the identity of the client.
+// If the request doesn't have the Authorization header, the verified client certificate is used as the identity.
+// If the request doesn't have any credentials, Authenticate returns ErrUnauthorized.
+func (a *Authenticator) Authenticate(req *http.Request) (*Identity, error) {
+	h := req.Header.Get("Authorization")
+	if h == "" {
+		if id := clientCertificateIdentity(req); id != nil {
+			return a.withStaticGroups(id), nil
+		}
+		return nil, ErrUnauthorized
+	}
+
+	if token, ok := strings.CutPrefix(h, "Bearer "); ok {
+		// The map is keyed by the digest of the token, so the lookup doesn't leak the token by timing.
+		if id, ok := a.tokens[sha256.Sum256([]byte(token))]; ok {
+			return id, nil
+		}
+		if a.jwtVerifier != nil && IsJWT(token) {
+			id, err := a.jwtVerifier.Verify(req.Context(), token)
+			if err != nil {
+				return nil, xerrors.Newf("%w: %v", ErrInvalidCredentials, err)
+			}
+			return a.withStaticGroups(id), nil
+		}
+		return nil, ErrInvalidCredentials
+	}
+	if username, password, ok := req.BasicAuth(); ok {
+		u, ok := a.users[username]
+		if !ok || !verifyPassword(u.PasswordHash, password) {
+			return nil, ErrInvalidCredentials
+		}
+		return u.Identity, nil
+	}
+
+	return nil, ErrInvalidCredentials
+}
+
+// clientCertificateIdentity returns the identity from the client certificate which is verified by TLS handshake.
+// The common name of the subject is used as the name and the organizational units are used as the groups.
+func clientCertificateIdentity(req *http.Request) *Identity {
+	if req.TLS == nil || len(req.TLS.VerifiedChains) == 0 || len(req.TLS.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	cert := req.TLS.VerifiedChains[0][0]
+	if cert.Subject.CommonName == "" {
+		return nil
+	}
+
+	id := &Identity{Name: cert.Subject.CommonName}
+	id.Groups = append(id.Groups, cert.Subject.OrganizationalUnit...)
+	sort.Strings(id.Groups)
+	return id
+}
+
+// withStaticGroups adds the groups which are configured statically to the identity.
+func (a *Authenticator) withStaticGroups(id *Identity) *Identity {
+	groups, ok := a.memberOf[id.Name]
+	if !ok {
+		return id
+	}
+
+	id.Groups = append(id.Groups, groups...)
+	sort.Strings(id.Groups)
+	return id
+}
+
+// AllowAnonymous returns true if the anonymous client can access to the route.
+func (a *Authenticator) AllowAnonymous(route string) bool {
+	return route == routeUpstream && a.anonymousUpstream
+}
+
+// ReadHtpasswdFile reads the users from the htpasswd file.
+func ReadHtpasswdFile(path string) ([]BasicUser, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, xerrors.WithStack(err)
+	}
+	defer f.Close()
+
+	return ReadHtpasswd(f)
+}
+
+func ReadHtpasswd(r io.Reader) ([]BasicUser, error) {
+	var users []BasicUser
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, hash, ok := strings.Cut(line, ":")
+		if !ok {
+			return nil, xerrors.Newf("malformed htpasswd line: %s", line)
+		}
+		users = append(users, BasicUser{Name: name, PasswordHash: hash})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, xerrors.WithStack(err)
+	}
+
+	return users, nil
+}
+
+func isSupportedPasswordHash(hash string) bool {
+	switch {
+	case strings.HasPrefix(hash, "$2y$"), strings.HasPrefix(hash, "$2a$"), strings.HasPrefix(hash, "$2b$"):
+		return true
+	case strings.HasPrefix(hash, "{SHA}"):
+		return true
+	default:
+		return false
+	}
+}
+
+func verifyPassword(hash, password string) bool {
+	if v, ok := strings.CutPrefix(hash, "{SHA}"); ok {
+		d := sha1.Sum([]byte(password))
+		return subtle.ConstantTimeCompare([]byte(v), []byte(base64.StdEncoding.EncodeToString(d[:]))) == 1
+	}
+
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
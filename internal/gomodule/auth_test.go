@@ -0,0 +1,68 @@
+package gomodule
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestAuthenticator(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	require.NoError(t, err)
+	users, err := ReadHtpasswd(strings.NewReader(
+		"# comment\n" +
+			"alice:" + string(hash) + "\n" +
+			// The password is "password"
+			"bob:{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g=\n",
+	))
+	require.NoError(t, err)
+	a, err := NewAuthenticator(
+		[]BearerToken{{Name: "ci", Token: "secret-token"}},
+		users,
+		map[string][]string{"developers": {"alice", "bob"}, "admins": {"alice"}},
+		nil,
+		true,
+	)
+	require.NoError(t, err)
+
+	cases := []struct {
+		Name     string
+		Setup    func(req *http.Request)
+		Identity string
+		Groups   []string
+		Err      error
+	}{
+		{Name: "Bearer", Setup: func(req *http.Request) { req.Header.Set("Authorization", "Bearer secret-token") }, Identity: "ci"},
+		{Name: "InvalidBearer", Setup: func(req *http.Request) { req.Header.Set("Authorization", "Bearer foobar") }, Err: ErrInvalidCredentials},
+		{Name: "Bcrypt", Setup: func(req *http.Request) { req.SetBasicAuth("alice", "password") }, Identity: "alice", Groups: []string{"admins", "developers"}},
+		{Name: "SHA", Setup: func(req *http.Request) { req.SetBasicAuth("bob", "password") }, Identity: "bob", Groups: []string{"developers"}},
+		{Name: "WrongPassword", Setup: func(req *http.Request) { req.SetBasicAuth("alice", "foobar") }, Err: ErrInvalidCredentials},
+		{Name: "UnknownUser", Setup: func(req *http.Request) { req.SetBasicAuth("carol", "password") }, Err: ErrInvalidCredentials},
+		{Name: "Anonymous", Setup: func(_ *http.Request) {}, Err: ErrUnauthorized},
+	}
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/example.com/foo/@v/list", nil)
+			tc.Setup(req)
+			id, err := a.Authenticate(req)
+			if tc.Err != nil {
+				assert.ErrorIs(t, err, tc.Err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.Identity, id.Name)
+			assert.Equal(t, tc.Groups, id.Groups)
+		})
+	}
+
+	assert.True(t, a.AllowAnonymous(routeUpstream))
+	assert.False(t, a.AllowAnonymous(routePrivate))
+
+	_, err = NewAuthenticator(nil, []BasicUser{{Name: "foo", PasswordHash: "$apr1$foo"}}, nil, nil, false)
+	assert.Error(t, err)
+}
@@ -0,0 +1,392 @@
+package gomodule
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"go.f110.dev/xerrors"
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
+	"golang.org/x/mod/sumdb/dirhash"
+)
+
+// BundleSumFile is the file in the root of the bundle which has the hashes of the modules in go.sum format.
+const BundleSumFile = "bundle.sum"
+
+// Bundler exports the module graph to the directory in GOPROXY layout.
+// The directory can be used as GOPROXY=file:///path/to/bundle or imported by ImportBundle.
+type Bundler struct {
+	proxy    *ModuleProxy
+	upstream *Upstream
+	dir      string
+	out      *ArtifactCache
+}
+
+// NewBundler returns Bundler.
+// The private modules are resolved by proxy and the other modules are resolved by upstream.
+func NewBundler(proxy *ModuleProxy, upstream *Upstream, dir string) *Bundler {
+	return &Bundler{proxy: proxy, upstream: upstream, dir: dir, out: NewArtifactCache(dir)}
+}
+
+// Export resolves the module graph from roots and writes .info and .mod of all modules in the graph.
+// .zip is written for the selected version of each module by minimal version selection.
+// If sums is not nil, the hashes of the modules are verified by it. The key of sums is the same as go.sum (e.g. "example.com/foo v1.0.0/go.mod").
+// Export returns the modules which are written with .zip.
+func (b *Bundler) Export(ctx context.Context, roots []module.Version, sums map[string]string) ([]module.Version, error) {
+	graph := make(map[module.Version]struct{})
+	var queue []module.Version
+	for _, v := range roots {
+		if v.Version == "" {
+			info, err := b.latest(ctx, v.Path)
+			if err != nil {
+				return nil, err
+			}
+			v.Version = info.Version
+		}
+		queue = append(queue, v)
+	}
+
+	hashes := make(map[string]string)
+	for len(queue) > 0 {
+		mod := queue[0]
+		queue = queue[1:]
+		if _, ok := graph[mod]; ok {
+			continue
+		}
+		graph[mod] = struct{}{}
+
+		if err := b.exportInfo(ctx, mod); err != nil {
+			return nil, err
+		}
+		goMod, err := b.exportGoMod(ctx, mod)
+		if err != nil {
+			return nil, err
+		}
+		h, err := dirhash.Hash1([]string{"go.mod"}, func(string) (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(goMod)), nil
+		})
+		if err != nil {
+			return nil, xerrors.WithStack(err)
+		}
+		hashes[mod.Path+" "+mod.Version+"/go.mod"] = h
+
+		f, err := modfile.ParseLax(mod.Path+"@"+mod.Version+"/go.mod", goMod, nil)
+		if err != nil {
+			return nil, xerrors.WithStack(err)
+		}
+		for _, v := range f.Require {
+			queue = append(queue, v.Mod)
+		}
+	}
+
+	selected := make(map[string]string)
+	versions := make(map[string][]string)
+	for v := range graph {
+		versions[v.Path] = append(versions[v.Path], v.Version)
+		if semver.Compare(v.Version, selected[v.Path]) > 0 {
+			selected[v.Path] = v.Version
+		}
+	}
+	var exported []module.Version
+	for p, ver := range selected {
+		mod := module.Version{Path: p, Version: ver}
+		h, err := b.exportZip(ctx, mod)
+		if err != nil {
+			return nil, err
+		}
+		hashes[mod.Path+" "+mod.Version] = h
+		exported = append(exported, mod)
+	}
+	for p, v := range versions {
+		if err := b.out.PutList(p, v); err != nil {
+			return nil, err
+		}
+	}
+
+	for k, h := range hashes {
+		if expect, ok := sums[k]; ok && expect != h {
+			return nil, xerrors.Newf("checksum mismatch %s: expected %s but got %s", k, expect, h)
+		}
+	}
+	if err := writeSums(filepath.Join(b.dir, BundleSumFile), hashes); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(exported, func(i, j int) bool { return exported[i].Path < exported[j].Path })
+	return exported, nil
+}
+
+func (b *Bundler) latest(ctx context.Context, mod string) (Info, error) {
+	if b.proxy.IsProxy(mod) {
+		return b.proxy.GetLatestVersion(ctx, mod)
+	}
+	return b.upstream.GetLatestVersion(ctx, mod)
+}
+
+func (b *Bundler) exportInfo(ctx context.Context, mod module.Version) error {
+	var info Info
+	if b.proxy.IsProxy(mod.Path) {
+		i, err := b.proxy.GetInfo(ctx, mod.Path, mod.Version)
+		if err != nil {
+			return err
+		}
+		info = i
+	} else {
+		i, err := b.upstream.GetInfo(ctx, mod.Path, mod.Version)
+		if err != nil {
+			return err
+		}
+		info = i
+	}
+
+	return b.out.Put(mod.Path, mod.Version, ArtifactInfo, func(w io.Writer) error {
+		return json.NewEncoder(w).Encode(info)
+	})
+}
+
+func (b *Bundler) exportGoMod(ctx context.Context, mod module.Version) ([]byte, error) {
+	var goMod []byte
+	if b.proxy.IsProxy(mod.Path) {
+		m, err := b.proxy.GetGoMod(ctx, mod.Path, mod.Version)
+		if err != nil {
+			return nil, err
+		}
+		goMod = []byte(m)
+	} else {
+		m, err := b.upstream.GetGoMod(ctx, mod.Path, mod.Version)
+		if err != nil {
+			return nil, err
+		}
+		goMod = m
+	}
+
+	err := b.out.Put(mod.Path, mod.Version, ArtifactMod, func(w io.Writer) error {
+		_, err := w.Write(goMod)
+		return xerrors.WithStack(err)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return goMod, nil
+}
+
+// exportZip writes .zip of the module and returns the hash of it.
+func (b *Bundler) exportZip(ctx context.Context, mod module.Version) (string, error) {
+	err := b.out.Put(mod.Path, mod.Version, ArtifactZip, func(w io.Writer) error {
+		if b.proxy.IsProxy(mod.Path) {
+			return b.proxy.GetZip(ctx, w, mod.Path, mod.Version)
+		}
+		return b.upstream.GetZip(ctx, w, mod.Path, mod.Version)
+	})
+	if err != nil {
+		return "", err
+	}
+
+	p, err := b.out.path(mod.Path, mod.Version, ArtifactZip)
+	if err != nil {
+		return "", err
+	}
+	h, err := dirhash.HashZip(p, dirhash.Hash1)
+	if err != nil {
+		return "", xerrors.WithStack(err)
+	}
+	return h, nil
+}
+
+// ImportBundle verifies the hashes of the bundle and copies the artifacts into the cache.
+// Only the artifacts whose hashes are in bundle.sum and the .info and the list of those modules are imported.
+// If the bundle has any other artifact, ImportBundle fails without importing anything.
+// The list files are merged with the existing one. ImportBundle returns the number of the imported files.
+func ImportBundle(dir string, cache *ArtifactCache) (int, error) {
+	sums, err := ReadGoSum(filepath.Join(dir, BundleSumFile))
+	if err != nil {
+		return 0, err
+	}
+	bundle := NewArtifactCache(dir)
+	// allowed has the artifacts which can be imported. The key is module.Version and the extension.
+	allowed := make(map[bundleArtifact]struct{})
+	versions := make(map[string]map[string]struct{})
+	for k, expect := range sums {
+		p, ver, ok := strings.Cut(k, " ")
+		if !ok {
+			return 0, xerrors.Newf("malformed entry of %s: %s", BundleSumFile, k)
+		}
+		var h string
+		if v, ok := strings.CutSuffix(ver, "/go.mod"); ok {
+			ver = v
+			f, err := bundle.Open(p, ver, ArtifactMod)
+			if err != nil {
+				return 0, xerrors.Newf("%s: %w", k, err)
+			}
+			h, err = dirhash.Hash1([]string{"go.mod"}, func(string) (io.ReadCloser, error) { return f, nil })
+			if err != nil {
+				return 0, xerrors.WithStack(err)
+			}
+			allowed[bundleArtifact{Path: p, Version: ver, Ext: ArtifactMod}] = struct{}{}
+		} else {
+			zp, err := bundle.path(p, ver, ArtifactZip)
+			if err != nil {
+				return 0, err
+			}
+			h, err = dirhash.HashZip(zp, dirhash.Hash1)
+			if err != nil {
+				return 0, xerrors.WithStack(err)
+			}
+			allowed[bundleArtifact{Path: p, Version: ver, Ext: ArtifactZip}] = struct{}{}
+		}
+		if h != expect {
+			return 0, xerrors.Newf("checksum mismatch %s: expected %s but got %s", k, expect, h)
+		}
+		allowed[bundleArtifact{Path: p, Version: ver, Ext: ArtifactInfo}] = struct{}{}
+		if versions[p] == nil {
+			versions[p] = make(map[string]struct{})
+		}
+		versions[p][ver] = struct{}{}
+	}
+
+	var artifacts []bundleArtifact
+	err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return xerrors.WithStack(err)
+		}
+		if d.IsDir() || filepath.Base(filepath.Dir(path)) != "@v" {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, filepath.Dir(filepath.Dir(path)))
+		if err != nil {
+			return xerrors.WithStack(err)
+		}
+		mod, err := module.UnescapePath(filepath.ToSlash(rel))
+		if err != nil {
+			return xerrors.WithStack(err)
+		}
+
+		name := filepath.Base(path)
+		if name == "list" {
+			listed, err := bundle.List(mod)
+			if err != nil {
+				return err
+			}
+			for _, v := range listed {
+				if _, ok := versions[mod][v]; !ok {
+					return xerrors.Newf("%s@%s in the list is not in %s", mod, v, BundleSumFile)
+				}
+			}
+			artifacts = append(artifacts, bundleArtifact{Path: mod, Ext: "list", file: path})
+			return nil
+		}
+
+		ext := strings.TrimPrefix(filepath.Ext(name), ".")
+		switch ext {
+		case ArtifactInfo, ArtifactMod, ArtifactZip:
+		default:
+			return nil
+		}
+		ver, err := module.UnescapeVersion(strings.TrimSuffix(name, "."+ext))
+		if err != nil {
+			return xerrors.WithStack(err)
+		}
+		a := bundleArtifact{Path: mod, Version: ver, Ext: ext}
+		if _, ok := allowed[a]; !ok {
+			return xerrors.Newf("%s@%s.%s is not in %s", mod, ver, ext, BundleSumFile)
+		}
+		a.file = path
+		artifacts = append(artifacts, a)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	for _, a := range artifacts {
+		if a.Ext == "list" {
+			listed, err := bundle.List(a.Path)
+			if err != nil {
+				return 0, err
+			}
+			if current, err := cache.List(a.Path); err == nil {
+				listed = append(listed, current...)
+			}
+			if err := cache.PutList(a.Path, listed); err != nil {
+				return 0, err
+			}
+			continue
+		}
+
+		err = cache.Put(a.Path, a.Version, a.Ext, func(w io.Writer) error {
+			f, err := os.Open(a.file)
+			if err != nil {
+				return xerrors.WithStack(err)
+			}
+			defer f.Close()
+			_, err = io.Copy(w, f)
+			return xerrors.WithStack(err)
+		})
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return len(artifacts), nil
+}
+
+// bundleArtifact is the file in the bundle. Version is empty for the list.
+type bundleArtifact struct {
+	Path    string
+	Version string
+	Ext     string
+
+	file string
+}
+
+// ReadGoSum reads go.sum and returns the map of "module version" to the hash.
+func ReadGoSum(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, xerrors.WithStack(err)
+	}
+	defer f.Close()
+
+	sums := make(map[string]string)
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) != 3 {
+			continue
+		}
+		sums[fields[0]+" "+fields[1]] = fields[2]
+	}
+	if err := s.Err(); err != nil {
+		return nil, xerrors.WithStack(err)
+	}
+
+	return sums, nil
+}
+
+func writeSums(path string, sums map[string]string) error {
+	keys := make([]string, 0, len(sums))
+	for k := range sums {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var buf bytes.Buffer
+	for _, k := range keys {
+		fmt.Fprintf(&buf, "%s %s\n", k, sums[k])
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		return xerrors.WithStack(err)
+	}
+
+	return nil
+}
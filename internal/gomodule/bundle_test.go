@@ -0,0 +1,135 @@
+package gomodule
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/mod/module"
+)
+
+// newTestUpstream returns the module proxy which serves the modules. The key of mods is module@version and the value is go.mod.
+func newTestUpstream(t *testing.T, mods map[string]string) *url.URL {
+	t.Helper()
+
+	files := make(map[string][]byte)
+	for k, goMod := range mods {
+		mod := ParseModuleVersion(k)
+		prefix := "/" + mod.Path + "/@v/" + mod.Version
+		info, err := json.Marshal(Info{Version: mod.Version, Time: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)})
+		require.NoError(t, err)
+		files[prefix+".info"] = info
+		files[prefix+".mod"] = []byte(goMod)
+
+		var buf bytes.Buffer
+		zw := zip.NewWriter(&buf)
+		w, err := zw.Create(k + "/go.mod")
+		require.NoError(t, err)
+		_, err = w.Write([]byte(goMod))
+		require.NoError(t, err)
+		require.NoError(t, zw.Close())
+		files[prefix+".zip"] = buf.Bytes()
+		files["/"+mod.Path+"/@v/list"] = append(files["/"+mod.Path+"/@v/list"], mod.Version+"\n"...)
+	}
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if buf, ok := files[req.URL.Path]; ok {
+			w.Write(buf)
+			return
+		}
+		http.NotFound(w, req)
+	}))
+	t.Cleanup(s.Close)
+	u, err := url.Parse(s.URL)
+	require.NoError(t, err)
+	return u
+}
+
+func TestBundle(t *testing.T) {
+	upstream := newTestUpstream(t, map[string]string{
+		"example.com/a@v1.0.0": "module example.com/a\n\nrequire (\n\texample.com/b v1.0.0\n\texample.com/c v1.0.0\n)\n",
+		"example.com/b@v1.0.0": "module example.com/b\n",
+		"example.com/b@v1.1.0": "module example.com/b\n",
+		"example.com/c@v1.0.0": "module example.com/c\n\nrequire example.com/b v1.1.0\n",
+	})
+	proxy := NewModuleProxy(nil, t.TempDir(), 0, nil, nil, nil)
+
+	bundleDir := t.TempDir()
+	bundler := NewBundler(proxy, NewUpstream([]*url.URL{upstream}), bundleDir)
+	exported, err := bundler.Export(context.Background(), []module.Version{{Path: "example.com/a", Version: "v1.0.0"}}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []module.Version{
+		{Path: "example.com/a", Version: "v1.0.0"},
+		{Path: "example.com/b", Version: "v1.1.0"},
+		{Path: "example.com/c", Version: "v1.0.0"},
+	}, exported)
+
+	list, err := os.ReadFile(filepath.Join(bundleDir, "example.com/b/@v/list"))
+	require.NoError(t, err)
+	assert.Equal(t, "v1.0.0\nv1.1.0\n", string(list))
+	// The zip of the version which is not selected is not exported
+	assert.NoFileExists(t, filepath.Join(bundleDir, "example.com/b/@v/v1.0.0.zip"))
+	assert.FileExists(t, filepath.Join(bundleDir, "example.com/b/@v/v1.0.0.mod"))
+	sums, err := ReadGoSum(filepath.Join(bundleDir, BundleSumFile))
+	require.NoError(t, err)
+	assert.Len(t, sums, 7)
+
+	t.Run("ChecksumMismatch", func(t *testing.T) {
+		_, err := NewBundler(proxy, NewUpstream([]*url.URL{upstream}), t.TempDir()).Export(
+			context.Background(),
+			[]module.Version{{Path: "example.com/b", Version: "v1.0.0"}},
+			map[string]string{"example.com/b v1.0.0/go.mod": "h1:AAAA="},
+		)
+		assert.Error(t, err)
+	})
+
+	t.Run("Import", func(t *testing.T) {
+		cache := NewArtifactCache(t.TempDir())
+		require.NoError(t, cache.PutList("example.com/b", []string{"v0.9.0"}))
+
+		n, err := ImportBundle(bundleDir, cache)
+		require.NoError(t, err)
+		assert.Equal(t, 14, n)
+		assert.True(t, cache.Has("example.com/c", "v1.0.0", ArtifactZip))
+		versions, err := cache.List("example.com/b")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"v0.9.0", "v1.0.0", "v1.1.0"}, versions)
+		latest, err := cache.Latest("example.com/b")
+		require.NoError(t, err)
+		assert.Equal(t, "v1.1.0", latest.Version)
+	})
+
+	t.Run("ImportUnlisted", func(t *testing.T) {
+		// The zip which is not selected is not in bundle.sum
+		p := filepath.Join(bundleDir, "example.com/b/@v/v1.0.0.zip")
+		require.NoError(t, os.WriteFile(p, newTestModuleZip(t, "example.com/b", "v1.0.0", map[string]string{"go.mod": "module example.com/b\n"}), 0644))
+		defer os.Remove(p)
+
+		cache := NewArtifactCache(t.TempDir())
+		_, err := ImportBundle(bundleDir, cache)
+		assert.Error(t, err)
+		assert.False(t, cache.Has("example.com/b", "v1.0.0", ArtifactZip))
+		assert.False(t, cache.Has("example.com/a", "v1.0.0", ArtifactZip))
+	})
+
+	t.Run("ImportTampered", func(t *testing.T) {
+		p := filepath.Join(bundleDir, "example.com/c/@v/v1.0.0.mod")
+		buf, err := os.ReadFile(p)
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(p, []byte(strings.ReplaceAll(string(buf), "v1.1.0", "v1.0.0")), 0644))
+
+		_, err = ImportBundle(bundleDir, NewArtifactCache(t.TempDir()))
+		assert.Error(t, err)
+	})
+}
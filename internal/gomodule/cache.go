@@ -0,0 +1,246 @@
+package gomodule
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"go.f110.dev/xerrors"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
+)
+
+var ErrCacheMiss = xerrors.New("cache miss")
+
+const (
+	ArtifactInfo = "info"
+	ArtifactMod  = "mod"
+	ArtifactZip  = "zip"
+)
+
+// ArtifactCache stores .info, .mod and .zip of the module on the disk.
+// The layout of the directory is the same as GOPROXY, so the directory can be served by a file server
+// or used as GOMODCACHE/cache/download.
+// Only the tagged version is stored because the tag is assumed to be immutable.
+// The nil value is valid and it doesn't store anything.
+type ArtifactCache struct {
+	dir string
+}
+
+func NewArtifactCache(dir string) *ArtifactCache {
+	return &ArtifactCache{dir: dir}
+}
+
+// Open returns the cached artifact. If the artifact is not cached, Open returns ErrCacheMiss.
+func (c *ArtifactCache) Open(mod, version, ext string) (*os.File, error) {
+	if c == nil {
+		return nil, ErrCacheMiss
+	}
+	p, err := c.path(mod, version, ext)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(p)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrCacheMiss
+	}
+	if err != nil {
+		return nil, xerrors.WithStack(err)
+	}
+
+	return f, nil
+}
+
+func (c *ArtifactCache) Has(mod, version, ext string) bool {
+	if c == nil {
+		return false
+	}
+	p, err := c.path(mod, version, ext)
+	if err != nil {
+		return false
+	}
+	_, err = os.Stat(p)
+	return err == nil
+}
+
+// Put stores the artifact which is written by fn.
+// The artifact is written to the temporary file first and renamed, so the reader never sees the partial file.
+func (c *ArtifactCache) Put(mod, version, ext string, fn func(w io.Writer) error) error {
+	if c == nil {
+		return nil
+	}
+	p, err := c.path(mod, version, ext)
+	if err != nil {
+		return err
+	}
+
+	return c.writeFile(p, fn)
+}
+
+func (c *ArtifactCache) writeFile(p string, fn func(w io.Writer) error) error {
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return xerrors.WithStack(err)
+	}
+	f, err := os.CreateTemp(filepath.Dir(p), "."+filepath.Base(p)+".*")
+	if err != nil {
+		return xerrors.WithStack(err)
+	}
+	defer os.Remove(f.Name())
+
+	if err := fn(f); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return xerrors.WithStack(err)
+	}
+	if err := os.Rename(f.Name(), p); err != nil {
+		return xerrors.WithStack(err)
+	}
+
+	return nil
+}
+
+func (c *ArtifactCache) path(mod, version, ext string) (string, error) {
+	escapedPath, err := module.EscapePath(mod)
+	if err != nil {
+		return "", xerrors.WithStack(err)
+	}
+	escapedVersion, err := module.EscapeVersion(version)
+	if err != nil {
+		return "", xerrors.WithStack(err)
+	}
+
+	return filepath.Join(c.dir, filepath.FromSlash(escapedPath), "@v", escapedVersion+"."+ext), nil
+}
+
+// List returns the versions in the list file of the module.
+func (c *ArtifactCache) List(mod string) ([]string, error) {
+	if c == nil {
+		return nil, ErrCacheMiss
+	}
+	p, err := c.listPath(mod)
+	if err != nil {
+		return nil, err
+	}
+	buf, err := os.ReadFile(p)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrCacheMiss
+	}
+	if err != nil {
+		return nil, xerrors.WithStack(err)
+	}
+
+	return strings.Fields(string(buf)), nil
+}
+
+// PutList writes the list file of the module. The versions are sorted by semver.
+func (c *ArtifactCache) PutList(mod string, versions []string) error {
+	if c == nil {
+		return nil
+	}
+	p, err := c.listPath(mod)
+	if err != nil {
+		return err
+	}
+	versions = slices.Clone(versions)
+	semver.Sort(versions)
+	versions = slices.Compact(versions)
+
+	return c.writeFile(p, func(w io.Writer) error {
+		for _, v := range versions {
+			if _, err := fmt.Fprintln(w, v); err != nil {
+				return xerrors.WithStack(err)
+			}
+		}
+		return nil
+	})
+}
+
+// Latest returns the info of the latest version in the list file.
+func (c *ArtifactCache) Latest(mod string) (Info, error) {
+	versions, err := c.List(mod)
+	if err != nil {
+		return Info{}, err
+	}
+	if len(versions) == 0 {
+		return Info{}, ErrCacheMiss
+	}
+	semver.Sort(versions)
+	f, err := c.Open(mod, versions[len(versions)-1], ArtifactInfo)
+	if err != nil {
+		return Info{}, err
+	}
+	defer f.Close()
+
+	var info Info
+	if err := json.NewDecoder(f).Decode(&info); err != nil {
+		return Info{}, xerrors.WithStack(err)
+	}
+
+	return info, nil
+}
+
+func (c *ArtifactCache) listPath(mod string) (string, error) {
+	escapedPath, err := module.EscapePath(mod)
+	if err != nil {
+		return "", xerrors.WithStack(err)
+	}
+
+	return filepath.Join(c.dir, filepath.FromSlash(escapedPath), "@v", "list"), nil
+}
+
+// PutLatest writes the @latest file of the module.
+func (c *ArtifactCache) PutLatest(mod string, info Info) error {
+	if c == nil {
+		return nil
+	}
+	escapedPath, err := module.EscapePath(mod)
+	if err != nil {
+		return xerrors.WithStack(err)
+	}
+
+	return c.writeFile(filepath.Join(c.dir, filepath.FromSlash(escapedPath), "@latest"), func(w io.Writer) error {
+		return xerrors.WithStack(json.NewEncoder(w).Encode(info))
+	})
+}
+
+// Purge removes the artifacts of the version. If version is empty, all versions of the module are removed.
+// The modules which are nested under the path of the module are not removed.
+func (c *ArtifactCache) Purge(mod, version string) error {
+	if c == nil {
+		return nil
+	}
+	if version != "" {
+		for _, ext := range []string{ArtifactInfo, ArtifactMod, ArtifactZip} {
+			p, err := c.path(mod, version, ext)
+			if err != nil {
+				return err
+			}
+			if err := os.Remove(p); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return xerrors.WithStack(err)
+			}
+		}
+		return nil
+	}
+
+	escapedPath, err := module.EscapePath(mod)
+	if err != nil {
+		return xerrors.WithStack(err)
+	}
+	dir := filepath.Join(c.dir, filepath.FromSlash(escapedPath))
+	if err := os.RemoveAll(filepath.Join(dir, "@v")); err != nil {
+		return xerrors.WithStack(err)
+	}
+	if err := os.Remove(filepath.Join(dir, "@latest")); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return xerrors.WithStack(err)
+	}
+
+	return nil
+}
@@ -0,0 +1,53 @@
+package gomodule
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestArtifactCache(t *testing.T) {
+	dir := t.TempDir()
+	c := NewArtifactCache(dir)
+
+	_, err := c.Open("github.com/Example/foo", "v1.0.0", ArtifactMod)
+	assert.ErrorIs(t, err, ErrCacheMiss)
+	assert.False(t, c.Has("github.com/Example/foo", "v1.0.0", ArtifactMod))
+
+	err = c.Put("github.com/Example/foo", "v1.0.0", ArtifactMod, func(w io.Writer) error {
+		_, err := io.WriteString(w, "module github.com/Example/foo\n")
+		return err
+	})
+	require.NoError(t, err)
+	assert.True(t, c.Has("github.com/Example/foo", "v1.0.0", ArtifactMod))
+	// The path is escaped like GOPROXY
+	_, err = os.Stat(filepath.Join(dir, "github.com/!example/foo/@v/v1.0.0.mod"))
+	require.NoError(t, err)
+
+	f, err := c.Open("github.com/Example/foo", "v1.0.0", ArtifactMod)
+	require.NoError(t, err)
+	buf, err := io.ReadAll(f)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	assert.Equal(t, "module github.com/Example/foo\n", string(buf))
+
+	// The failed artifact is not stored
+	err = c.Put("github.com/Example/foo", "v1.0.0", ArtifactZip, func(w io.Writer) error {
+		return io.ErrUnexpectedEOF
+	})
+	assert.Error(t, err)
+	assert.False(t, c.Has("github.com/Example/foo", "v1.0.0", ArtifactZip))
+	entries, err := os.ReadDir(filepath.Join(dir, "github.com/!example/foo/@v"))
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+
+	// nil is valid
+	var nilCache *ArtifactCache
+	assert.NoError(t, nilCache.Put("github.com/Example/foo", "v1.0.0", ArtifactMod, nil))
+	_, err = nilCache.Open("github.com/Example/foo", "v1.0.0", ArtifactMod)
+	assert.ErrorIs(t, err, ErrCacheMiss)
+}
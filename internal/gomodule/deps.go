@@ -0,0 +1,239 @@
+package gomodule
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"sync"
+
+	"github.com/go-logr/logr"
+	"github.com/gorilla/mux"
+	"go.f110.dev/xerrors"
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
+)
+
+// depsFetchConcurrency is the number of the repositories which are fetched concurrently to find the reverse dependencies.
+const depsFetchConcurrency = 4
+
+// Requirement is the module which is required by go.mod.
+type Requirement struct {
+	Path     string `json:"path"`
+	Version  string `json:"version"`
+	Indirect bool   `json:"indirect,omitempty"`
+}
+
+// ModuleRequirements is the requirements of the version of the module.
+type ModuleRequirements struct {
+	Module   string        `json:"module"`
+	Version  string        `json:"version"`
+	Requires []Requirement `json:"requires"`
+}
+
+// ReverseDependency is the version of the module which requires the other module.
+// Requires is the version of the required module.
+type ReverseDependency struct {
+	Module   string `json:"module"`
+	Version  string `json:"version"`
+	Requires string `json:"requires"`
+}
+
+// DependencyGraph is the dependency graph of the private modules which is built from go.mod of every version.
+// go.mod of the version is parsed once because the version is immutable.
+type DependencyGraph struct {
+	mu       sync.Mutex
+	requires map[module.Version][]Requirement
+
+	// goMod is replaced in the test
+	goMod func(mod *Module, version string) ([]byte, error)
+}
+
+func NewDependencyGraph() *DependencyGraph {
+	return &DependencyGraph{
+		requires: make(map[module.Version][]Requirement),
+		goMod: func(mod *Module, version string) ([]byte, error) {
+			return mod.ModuleFile(version)
+		},
+	}
+}
+
+// Requires returns the requirements of the version of the module.
+func (g *DependencyGraph) Requires(mod *Module, version string) ([]Requirement, error) {
+	key := module.Version{Path: mod.Path, Version: version}
+	g.mu.Lock()
+	reqs, ok := g.requires[key]
+	g.mu.Unlock()
+	if ok {
+		return reqs, nil
+	}
+
+	buf, err := g.goMod(mod, version)
+	if err != nil {
+		return nil, err
+	}
+	f, err := modfile.ParseLax(mod.Path+"@"+version+"/go.mod", buf, nil)
+	if err != nil {
+		return nil, xerrors.WithStack(err)
+	}
+	reqs = []Requirement{}
+	for _, v := range f.Require {
+		reqs = append(reqs, Requirement{Path: v.Mod.Path, Version: v.Mod.Version, Indirect: v.Indirect})
+	}
+
+	g.mu.Lock()
+	g.requires[key] = reqs
+	g.mu.Unlock()
+	return reqs, nil
+}
+
+// Dependencies returns the requirements of every version of the module in descending order of the version.
+// The version whose go.mod can not be read is skipped.
+func (g *DependencyGraph) Dependencies(mod *Module) []ModuleRequirements {
+	var result []ModuleRequirements
+	for i := len(mod.Versions) - 1; i >= 0; i-- {
+		ver := mod.Versions[i].Semver
+		reqs, err := g.Requires(mod, ver)
+		if err != nil {
+			continue
+		}
+		result = append(result, ModuleRequirements{Module: mod.Path, Version: ver, Requires: reqs})
+	}
+
+	return result
+}
+
+// ReverseDependencies returns the versions of the modules in roots which require target.
+// If latestOnly is true, only the latest version of each module is examined.
+// filter is called with the path of the dependent module. If filter returns false, the module is omitted.
+func (g *DependencyGraph) ReverseDependencies(roots []*ModuleRoot, target string, latestOnly bool, filter func(string) bool) []ReverseDependency {
+	var result []ReverseDependency
+	for _, root := range roots {
+		for _, mod := range root.Modules {
+			if mod.Path == target || len(mod.Versions) == 0 || !filter(mod.Path) {
+				continue
+			}
+
+			versions := mod.Versions
+			if latestOnly {
+				versions = versions[len(versions)-1:]
+			}
+			for _, v := range versions {
+				reqs, err := g.Requires(mod, v.Semver)
+				if err != nil {
+					continue
+				}
+				for _, r := range reqs {
+					if r.Path == target {
+						result = append(result, ReverseDependency{Module: mod.Path, Version: v.Semver, Requires: r.Version})
+					}
+				}
+			}
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Module != result[j].Module {
+			return result[i].Module < result[j].Module
+		}
+		return semver.Compare(result[i].Version, result[j].Version) > 0
+	})
+
+	return result
+}
+
+// DepsHandler serves the dependency graph of the private modules in JSON.
+//
+//	GET /_deps/{module}?version=...   returns the requirements of every version (or the given version) of the module
+//	GET /_rdeps/{module}?latest=true  returns the versions of the private modules which require the module
+//
+// The reverse dependencies are found in the repositories which have been fetched. The configured modules are fetched by Seed.
+// The modules which are configured by a pattern are examined only after they are fetched because they can not be enumerated.
+// The modules which the client can not access are omitted.
+type DepsHandler struct {
+	proxy  *ModuleProxy
+	graph  *DependencyGraph
+	auth   *Authenticator
+	logger logr.Logger
+}
+
+// NewDepsHandler returns DepsHandler. If auth is nil, the clients are not authenticated.
+func NewDepsHandler(proxy *ModuleProxy, auth *Authenticator, logger logr.Logger) *DepsHandler {
+	return &DepsHandler{proxy: proxy, graph: NewDependencyGraph(), auth: auth, logger: logger}
+}
+
+// Seed fetches the repositories of the configured modules so that the reverse dependencies are found after the process starts.
+// It should be called once in the background at startup. rdeps doesn't fetch any repository.
+func (h *DepsHandler) Seed(ctx context.Context) {
+	h.proxy.FetchConfiguredModules(ctx, depsFetchConcurrency, func(mod string, err error) {
+		if err != nil {
+			h.logger.Info("Failed to fetch the module", "module", mod, xerrors.ZapField(err))
+		}
+	})
+}
+
+func (h *DepsHandler) Handler() http.Handler {
+	r := mux.NewRouter()
+	r.Methods(http.MethodGet).Path("/_deps/{module:.+}").HandlerFunc(h.deps)
+	r.Methods(http.MethodGet).Path("/_rdeps/{module:.+}").HandlerFunc(h.rdeps)
+	r.Use(middlewareBrowserAuth(h.auth))
+
+	return r
+}
+
+func (h *DepsHandler) deps(w http.ResponseWriter, req *http.Request) {
+	modPath := mux.Vars(req)["module"]
+	if !h.proxy.IsProxy(modPath) || !h.proxy.IsAllowed(modPath, IdentityFromContext(req.Context())) {
+		writeJSONError(w, http.StatusNotFound, xerrors.Newf("%s is not found", modPath))
+		return
+	}
+	root, err := h.proxy.ModuleRoot(req.Context(), modPath)
+	if err != nil {
+		h.logger.Info("Failed to fetch the module", "module", modPath, xerrors.ZapField(err))
+		writeJSONError(w, http.StatusNotFound, xerrors.Newf("%s is not found", modPath))
+		return
+	}
+	var mod *Module
+	for _, v := range root.Modules {
+		if v.Path == modPath {
+			mod = v
+			break
+		}
+	}
+	if mod == nil {
+		writeJSONError(w, http.StatusNotFound, xerrors.Newf("%s is not found", modPath))
+		return
+	}
+
+	if version := req.URL.Query().Get("version"); version != "" {
+		reqs, err := h.graph.Requires(mod, version)
+		if err != nil {
+			writeJSONError(w, http.StatusNotFound, xerrors.Newf("%s@%s is not found", modPath, version))
+			return
+		}
+		writeJSON(w, http.StatusOK, []ModuleRequirements{{Module: mod.Path, Version: version, Requires: reqs}})
+		return
+	}
+	deps := h.graph.Dependencies(mod)
+	if deps == nil {
+		deps = []ModuleRequirements{}
+	}
+	writeJSON(w, http.StatusOK, deps)
+}
+
+func (h *DepsHandler) rdeps(w http.ResponseWriter, req *http.Request) {
+	modPath := mux.Vars(req)["module"]
+	id := IdentityFromContext(req.Context())
+	if !h.proxy.IsAllowed(modPath, id) {
+		writeJSONError(w, http.StatusNotFound, xerrors.Newf("%s is not found", modPath))
+		return
+	}
+
+	latestOnly := req.URL.Query().Get("latest") == "true"
+	rdeps := h.graph.ReverseDependencies(h.proxy.ModuleRoots(), modPath, latestOnly, func(mod string) bool {
+		return h.proxy.IsAllowed(mod, id)
+	})
+	if rdeps == nil {
+		rdeps = []ReverseDependency{}
+	}
+	writeJSON(w, http.StatusOK, rdeps)
+}
@@ -0,0 +1,92 @@
+package gomodule
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/go-logr/logr"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.f110.dev/xerrors"
+)
+
+func TestDependencyGraph(t *testing.T) {
+	goMods := map[string]string{
+		"example.com/lib@v1.0.0": "module example.com/lib\n",
+		"example.com/lib@v1.1.0": "module example.com/lib\n",
+		"example.com/app@v0.1.0": "module example.com/app\n\nrequire example.com/lib v1.0.0\n",
+		"example.com/app@v0.2.0": "module example.com/app\n\nrequire (\n\texample.com/lib v1.1.0\n\tgolang.org/x/mod v0.1.0 // indirect\n)\n",
+		"example.com/cli@v1.0.0": "module example.com/cli\n\nrequire example.com/lib v1.0.0\n",
+	}
+	parsed := 0
+	g := NewDependencyGraph()
+	g.goMod = func(mod *Module, version string) ([]byte, error) {
+		parsed++
+		if v, ok := goMods[mod.Path+"@"+version]; ok {
+			return []byte(v), nil
+		}
+		return nil, xerrors.New("not found")
+	}
+	versions := func(vers ...string) []*ModuleVersion {
+		var result []*ModuleVersion
+		for _, v := range vers {
+			result = append(result, &ModuleVersion{Version: v, Semver: v})
+		}
+		return result
+	}
+	lib := &Module{Path: "example.com/lib", Versions: versions("v1.0.0", "v1.1.0")}
+	app := &Module{Path: "example.com/app", Versions: versions("v0.1.0", "v0.2.0")}
+	cli := &Module{Path: "example.com/cli", Versions: versions("v0.9.0", "v1.0.0")}
+	roots := []*ModuleRoot{{RootPath: "example.com/app", Modules: []*Module{app, cli}}, {RootPath: "example.com/lib", Modules: []*Module{lib}}}
+
+	deps := g.Dependencies(app)
+	require.Len(t, deps, 2)
+	assert.Equal(t, "v0.2.0", deps[0].Version)
+	assert.Equal(t, []Requirement{{Path: "example.com/lib", Version: "v1.1.0"}, {Path: "golang.org/x/mod", Version: "v0.1.0", Indirect: true}}, deps[0].Requires)
+
+	rdeps := g.ReverseDependencies(roots, "example.com/lib", false, func(string) bool { return true })
+	assert.Equal(t, []ReverseDependency{
+		{Module: "example.com/app", Version: "v0.2.0", Requires: "v1.1.0"},
+		{Module: "example.com/app", Version: "v0.1.0", Requires: "v1.0.0"},
+		{Module: "example.com/cli", Version: "v1.0.0", Requires: "v1.0.0"},
+	}, rdeps)
+	rdeps = g.ReverseDependencies(roots, "example.com/lib", true, func(mod string) bool { return mod != "example.com/cli" })
+	assert.Equal(t, []ReverseDependency{{Module: "example.com/app", Version: "v0.2.0", Requires: "v1.1.0"}}, rdeps)
+
+	// go.mod is parsed once for each version. The version which go.mod can not be read is retried
+	n := parsed
+	g.ReverseDependencies(roots, "example.com/lib", false, func(string) bool { return true })
+	assert.Equal(t, n+1, parsed)
+}
+
+func TestDepsHandler_ReverseDependencies(t *testing.T) {
+	lib := newTestGitRepository(t, map[string]string{"go.mod": "module example.com/lib\n"}, "v1.0.0")
+	app := newTestGitRepository(t, map[string]string{"go.mod": "module example.com/app\n\nrequire example.com/lib v1.0.0\n"}, "v0.1.0")
+	// The repositories have not been fetched yet like the process has just started
+	proxy := NewModuleProxy([]*ModuleRule{
+		{Match: regexp.MustCompile(`^example\.com/lib(/|$)`), Repository: lib, Prefix: "example.com/lib"},
+		{Match: regexp.MustCompile(`^example\.com/app(/|$)`), Repository: app, Prefix: "example.com/app"},
+	}, t.TempDir(), 0, nil, nil, nil)
+	deps := NewDepsHandler(proxy, nil, logr.Discard())
+	h := deps.Handler()
+
+	// The request doesn't fetch any repository
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/_rdeps/example.com/lib", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, "[]", rec.Body.String())
+	assert.Empty(t, proxy.Repositories())
+
+	deps.Seed(context.Background())
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/_rdeps/example.com/lib", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	var rdeps []ReverseDependency
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &rdeps))
+	assert.Equal(t, []ReverseDependency{{Module: "example.com/app", Version: "v0.1.0", Requires: "v1.0.0"}}, rdeps)
+}
@@ -10,13 +10,18 @@ import (
 	"path/filepath"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
 	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/go-git/go-git/v5/plumbing/filemode"
 	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/storage/memory"
 	"go.f110.dev/xerrors"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/mod/modfile"
 	"golang.org/x/mod/semver"
 	"golang.org/x/tools/go/vcs"
@@ -44,44 +49,283 @@ type ModuleVersion struct {
 	Version string
 	Semver  string
 	Time    time.Time
+	// Commit is the hash of the commit which the tag points to.
+	Commit string
 }
 
 type ModuleFetcher struct {
-	baseDir string
+	baseDir         string
+	refreshInterval time.Duration
+	metrics         *Metrics
+
+	// repositories is the map of the repository root to *repository.
+	repositories sync.Map
+	// observers are called with the modules and the versions every time the repository is discovered.
+	observers []func(*ModuleRoot)
+	// resolve returns the repository of the import path. It is replaced by ModuleProxy to resolve the vanity import path.
+	resolve func(importPath string) (*vcs.RepoRoot, error)
 }
 
-func NewModuleFetcher(baseDir string) *ModuleFetcher {
-	return &ModuleFetcher{baseDir: baseDir}
+// repository is the state of the repository.
+// The repository is updated by one goroutine at a time.
+type repository struct {
+	mu        sync.Mutex
+	repoRoot  *vcs.RepoRoot
+	root      *ModuleRoot
+	fetchedAt time.Time
+	// lastError is the error of the last fetch. It is nil if the last fetch succeeded.
+	lastError     error
+	lastAttemptAt time.Time
+}
+
+// RepositoryStatus is the state of the repository which has been fetched.
+type RepositoryStatus struct {
+	Root          string    `json:"root"`
+	URL           string    `json:"url"`
+	Dir           string    `json:"dir"`
+	Modules       []string  `json:"modules"`
+	FetchedAt     time.Time `json:"fetched_at,omitempty"`
+	LastAttemptAt time.Time `json:"last_attempt_at,omitempty"`
+	LastError     string    `json:"last_error,omitempty"`
+}
+
+// NewModuleFetcher returns ModuleFetcher.
+// The repository is fetched from the remote again when refreshInterval has elapsed since the last fetch.
+// If refreshInterval is zero, the repository is fetched every time.
+func NewModuleFetcher(baseDir string, refreshInterval time.Duration, metrics *Metrics) *ModuleFetcher {
+	return &ModuleFetcher{baseDir: baseDir, refreshInterval: refreshInterval, metrics: metrics, resolve: resolveRepoRoot}
 }
 
 func (f *ModuleFetcher) Fetch(ctx context.Context, importPath string) (*ModuleRoot, error) {
-	repoRoot, err := vcs.RepoRootForImportPath(importPath, false)
+	ctx, span := tracer.Start(ctx, "ModuleFetcher.Fetch", trace.WithAttributes(attribute.String("module", importPath)))
+	defer span.End()
+
+	_, rSpan := tracer.Start(ctx, "vcs.RepoRootForImportPath")
+	repoRoot, err := f.resolve(importPath)
+	endSpan(rSpan, err)
 	if err != nil {
-		return nil, xerrors.WithStack(err)
+		return nil, err
 	}
+	span.SetAttributes(attribute.String("repository", repoRoot.Root))
 
+	repo := f.repository(repoRoot.Root)
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	repo.repoRoot = repoRoot
+	if repo.root != nil && time.Since(repo.fetchedAt) < f.refreshInterval {
+		span.SetAttributes(attribute.Bool("cached", true))
+		return repo.root, nil
+	}
+
+	repo.lastAttemptAt = time.Now()
 	dir := filepath.Join(f.baseDir, repoRoot.Root)
 	vcsRepo := NewVCS("git", repoRoot.Repo)
-	if err := f.updateOrCreate(ctx, vcsRepo, dir); err != nil {
+	err = f.updateOrCreate(ctx, vcsRepo, dir)
+	f.metrics.ObserveGitFetch(repoRoot.Root, time.Since(repo.lastAttemptAt), err)
+	if err != nil {
+		repo.lastError = err
+		return nil, err
+	}
+
+	moduleRoot, err := f.discover(ctx, repoRoot, vcsRepo, dir)
+	repo.lastError = err
+	if err != nil {
+		return nil, err
+	}
+	repo.root = moduleRoot
+	repo.fetchedAt = time.Now()
+
+	return moduleRoot, nil
+}
+
+// Archive writes the zip of the version of the module to w.
+// The repository is locked while the local clone is read so that it is not updated by the other fetch at the same time.
+func (f *ModuleFetcher) Archive(ctx context.Context, w io.Writer, importPath, version string) error {
+	moduleRoot, err := f.Fetch(ctx, importPath)
+	if err != nil {
+		return err
+	}
+
+	return f.ArchiveRoot(ctx, w, moduleRoot, importPath, version)
+}
+
+// ArchiveRoot writes the zip of the version of the module in moduleRoot to w without fetching the repository.
+// The repository is locked while the local clone is read as well as Archive.
+func (f *ModuleFetcher) ArchiveRoot(ctx context.Context, w io.Writer, moduleRoot *ModuleRoot, importPath, version string) error {
+	repo := f.repository(moduleRoot.RootPath)
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	_, span := tracer.Start(ctx, "ModuleRoot.Archive")
+	err := moduleRoot.Archive(w, importPath, version)
+	endSpan(span, err)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Rediscover finds the modules and the versions in the local clone of the repository again without fetching from the remote.
+func (f *ModuleFetcher) Rediscover(ctx context.Context, repoRoot string) (*ModuleRoot, error) {
+	v, ok := f.repositories.Load(repoRoot)
+	if !ok {
+		return nil, xerrors.Newf("%s is not fetched yet", repoRoot)
+	}
+	repo := v.(*repository)
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	if repo.repoRoot == nil {
+		return nil, xerrors.Newf("%s is not fetched yet", repoRoot)
+	}
+
+	dir := filepath.Join(f.baseDir, repo.repoRoot.Root)
+	vcsRepo := NewVCS("git", repo.repoRoot.Repo)
+	if err := vcsRepo.Open(dir); err != nil {
 		return nil, err
 	}
+	moduleRoot, err := f.discover(ctx, repo.repoRoot, vcsRepo, dir)
+	if err != nil {
+		return nil, err
+	}
+	repo.root = moduleRoot
+
+	return moduleRoot, nil
+}
+
+// Repositories returns the state of the repositories which have been fetched.
+func (f *ModuleFetcher) Repositories() []RepositoryStatus {
+	var repos []RepositoryStatus
+	f.repositories.Range(func(_, value any) bool {
+		repo := value.(*repository)
+		repo.mu.Lock()
+		defer repo.mu.Unlock()
+		if repo.repoRoot == nil {
+			return true
+		}
+
+		status := RepositoryStatus{
+			Root:          repo.repoRoot.Root,
+			URL:           repo.repoRoot.Repo,
+			Dir:           filepath.Join(f.baseDir, repo.repoRoot.Root),
+			FetchedAt:     repo.fetchedAt,
+			LastAttemptAt: repo.lastAttemptAt,
+		}
+		if repo.root != nil {
+			for _, m := range repo.root.Modules {
+				status.Modules = append(status.Modules, m.Path)
+			}
+		}
+		if repo.lastError != nil {
+			status.LastError = repo.lastError.Error()
+		}
+		repos = append(repos, status)
+		return true
+	})
+	sort.Slice(repos, func(i, j int) bool { return repos[i].Root < repos[j].Root })
+
+	return repos
+}
 
+// Roots returns the modules and the versions of the repositories which have been fetched.
+func (f *ModuleFetcher) Roots() []*ModuleRoot {
+	var roots []*ModuleRoot
+	f.repositories.Range(func(_, value any) bool {
+		repo := value.(*repository)
+		repo.mu.Lock()
+		defer repo.mu.Unlock()
+		if repo.root != nil {
+			roots = append(roots, repo.root)
+		}
+		return true
+	})
+	sort.Slice(roots, func(i, j int) bool { return roots[i].RootPath < roots[j].RootPath })
+
+	return roots
+}
+
+func (f *ModuleFetcher) discover(ctx context.Context, repoRoot *vcs.RepoRoot, vcsRepo *VCS, dir string) (*ModuleRoot, error) {
 	moduleRoot := NewModuleRoot(repoRoot, vcsRepo, dir)
+	_, mSpan := tracer.Start(ctx, "ModuleRoot.findModules")
 	modules, err := moduleRoot.findModules()
+	endSpan(mSpan, err)
 	if err != nil {
 		return nil, err
 	}
 	moduleRoot.Modules = modules
 
-	if err := moduleRoot.findVersions(); err != nil {
+	_, vSpan := tracer.Start(ctx, "ModuleRoot.findVersions")
+	err = moduleRoot.findVersions()
+	endSpan(vSpan, err)
+	if err != nil {
 		return nil, err
 	}
+	for _, fn := range f.observers {
+		fn(moduleRoot)
+	}
 
 	return moduleRoot, nil
 }
 
+// AddObserver registers fn which is called with the modules and the versions every time the repository is discovered.
+// It must be called before fetching any repository.
+func (f *ModuleFetcher) AddObserver(fn func(*ModuleRoot)) {
+	f.observers = append(f.observers, fn)
+}
+
+// Refresh fetches the repository of importPath from the remote regardless of refreshInterval.
+func (f *ModuleFetcher) Refresh(ctx context.Context, importPath string) (*ModuleRoot, error) {
+	repoRoot, err := f.resolve(importPath)
+	if err != nil {
+		return nil, err
+	}
+	f.Invalidate(repoRoot.Root)
+
+	return f.Fetch(ctx, importPath)
+}
+
+// Invalidate discards the cached modules and versions of the repository.
+func (f *ModuleFetcher) Invalidate(repoRoot string) {
+	repo := f.repository(repoRoot)
+	repo.mu.Lock()
+	repo.root = nil
+	repo.mu.Unlock()
+}
+
+func resolveRepoRoot(importPath string) (*vcs.RepoRoot, error) {
+	repoRoot, err := vcs.RepoRootForImportPath(importPath, false)
+	if err != nil {
+		return nil, xerrors.WithStack(err)
+	}
+
+	return repoRoot, nil
+}
+
+func (f *ModuleFetcher) repository(repoRoot string) *repository {
+	v, _ := f.repositories.LoadOrStore(repoRoot, &repository{})
+	return v.(*repository)
+}
+
+// Ping checks whether the remote repository of importPath is reachable without touching the local clone.
+func (f *ModuleFetcher) Ping(ctx context.Context, importPath string) error {
+	repoRoot, err := f.resolve(importPath)
+	if err != nil {
+		return err
+	}
+
+	remote := git.NewRemote(memory.NewStorage(), &config.RemoteConfig{
+		Name: "origin",
+		URLs: []string{repoRoot.Repo},
+	})
+	if _, err := remote.ListContext(ctx, &git.ListOptions{}); err != nil {
+		return xerrors.WithStack(err)
+	}
+
+	return nil
+}
+
 func (f *ModuleFetcher) updateOrCreate(ctx context.Context, repo *VCS, dir string) error {
 	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		f.metrics.CacheMiss()
 		if err := os.MkdirAll(dir, 0755); err != nil {
 			return xerrors.WithStack(err)
 		}
@@ -89,6 +333,7 @@ func (f *ModuleFetcher) updateOrCreate(ctx context.Context, repo *VCS, dir strin
 			return xerrors.WithStack(err)
 		}
 	} else {
+		f.metrics.CacheHit()
 		if err := repo.Download(ctx, dir); err != nil {
 			return xerrors.WithStack(err)
 		}
@@ -344,8 +589,10 @@ func (m *ModuleRoot) findVersions() error {
 				switch v := obj.(type) {
 				case *object.Tag:
 					modVer.Time = v.Tagger.When.In(time.UTC)
+					modVer.Commit = v.Target.String()
 				case *object.Commit:
 					modVer.Time = v.Author.When.In(time.UTC)
+					modVer.Commit = v.Hash.String()
 				}
 			} else {
 				log.Printf("Failed to get tag object %s %s: %v", ver, ref.Hash().String(), err)
@@ -452,10 +699,12 @@ func NewVCS(typ, url string) *VCS {
 }
 
 func (vcs *VCS) Create(ctx context.Context, dir string) error {
+	ctx, span := tracer.Start(ctx, "VCS.Create", trace.WithAttributes(attribute.String("url", vcs.URL)))
 	repo, err := git.PlainCloneContext(ctx, dir, false, &git.CloneOptions{
 		URL:        vcs.URL,
 		NoCheckout: true,
 	})
+	endSpan(span, err)
 	if err != nil {
 		return xerrors.WithStack(err)
 	}
@@ -468,8 +717,13 @@ func (vcs *VCS) Download(ctx context.Context, dir string) error {
 	if err := vcs.Open(dir); err != nil {
 		return err
 	}
+	ctx, span := tracer.Start(ctx, "VCS.Download", trace.WithAttributes(attribute.String("url", vcs.URL)))
 	err := vcs.gitRepo.FetchContext(ctx, &git.FetchOptions{RemoteName: "origin"})
-	if err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) {
+	if errors.Is(err, git.NoErrAlreadyUpToDate) {
+		err = nil
+	}
+	endSpan(span, err)
+	if err != nil {
 		return xerrors.WithStack(err)
 	}
 
@@ -15,6 +15,44 @@ import (
 	"golang.org/x/tools/go/vcs"
 )
 
+// newTestGitRepository creates the git repository which has files in one commit and returns the directory.
+// tags are created on the commit.
+func newTestGitRepository(t *testing.T, files map[string]string, tags ...string) string {
+	dir := t.TempDir()
+	repo, err := git.PlainInit(dir, false)
+	require.NoError(t, err)
+	wt, err := repo.Worktree()
+	require.NoError(t, err)
+
+	for name, content := range files {
+		err = os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0755)
+		require.NoError(t, err)
+		err = os.WriteFile(filepath.Join(dir, name), []byte(content), 0644)
+		require.NoError(t, err)
+		_, err = wt.Add(name)
+		require.NoError(t, err)
+	}
+	commitHash, err := wt.Commit("init", &git.CommitOptions{
+		Author: &object.Signature{
+			Email: "test@example.com",
+			When:  time.Now(),
+		},
+	})
+	require.NoError(t, err)
+	for _, v := range tags {
+		_, err = repo.CreateTag(v, commitHash, &git.CreateTagOptions{
+			Tagger: &object.Signature{
+				Email: "test@example.com",
+				When:  time.Now(),
+			},
+			Message: v,
+		})
+		require.NoError(t, err)
+	}
+
+	return dir
+}
+
 func TestModuleRoot(t *testing.T) {
 	dir := t.TempDir()
 	repo, err := git.PlainInit(dir, false)
@@ -76,7 +114,7 @@ func TestModuleRoot(t *testing.T) {
 	}
 	moduleRoot := &ModuleRoot{
 		dir:      dir,
-		repoRoot: repoRoot,
+		RootPath: repoRoot.Root,
 		vcs:      vcsRepo,
 	}
 	modules, err := moduleRoot.findModules()
@@ -0,0 +1,323 @@
+package gomodule
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"io"
+	"strings"
+
+	"go.f110.dev/xerrors"
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/semver"
+	"golang.org/x/tools/go/vcs"
+)
+
+const defaultForkSuffix = "fork"
+
+// ErrNotForked is returned when the version of the module is not served from the fork.
+var ErrNotForked = xerrors.New("the version is not served from the fork")
+
+// ForkRule substitutes the fork repository for the upstream module.
+// The tags of the fork in [MinVersion, MaxVersion) are served under the upstream module path with Suffix (e.g. v1.2.3 -> v1.2.3-fork).
+// The other versions of the module are served by the upstream.
+//
+// The versions of the fork are not in the checksum database, so the clients need GONOSUMDB for the module.
+// The version of the fork is a pre-release of the tag, so the minimal version selection prefers the release version of the same tag.
+type ForkRule struct {
+	// Module is the module path of the upstream.
+	Module     string
+	Repository string
+	// MinVersion is inclusive and MaxVersion is exclusive. If empty, the range is not bounded.
+	MinVersion string
+	MaxVersion string
+	// Suffix is added to the version of the fork. If empty, "fork" is used.
+	Suffix string
+}
+
+// ForkInfo is the origin of the version which is served from the fork. It is added to .info.
+type ForkInfo struct {
+	Repository string
+	// Tag is the tag of the fork repository.
+	Tag    string
+	Commit string
+}
+
+func (r *ForkRule) contains(version string) bool {
+	if r.MinVersion != "" && semver.Compare(version, r.MinVersion) < 0 {
+		return false
+	}
+	if r.MaxVersion != "" && semver.Compare(version, r.MaxVersion) >= 0 {
+		return false
+	}
+
+	return true
+}
+
+// forkVersion returns the version which is served for the tag of the fork.
+func (r *ForkRule) forkVersion(tag string) string {
+	if semver.Prerelease(tag) != "" {
+		return tag + "." + r.suffix()
+	}
+	return tag + "-" + r.suffix()
+}
+
+// tag returns the tag of the fork for the version which is served under the upstream module path.
+// It returns false if the version is not in the range of the rule, so the repository of the fork doesn't have to be fetched.
+func (r *ForkRule) tag(version string) (string, bool) {
+	for _, sep := range []string{"-", "."} {
+		tag := strings.TrimSuffix(version, sep+r.suffix())
+		if tag == version || !semver.IsValid(tag) || r.forkVersion(tag) != version {
+			continue
+		}
+		return tag, r.contains(tag)
+	}
+
+	return "", false
+}
+
+func (r *ForkRule) suffix() string {
+	if r.Suffix == "" {
+		return defaultForkSuffix
+	}
+	return r.Suffix
+}
+
+// SetForks replaces the fork rules.
+func (m *ModuleProxy) SetForks(forks []*ForkRule) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.forks = forks
+}
+
+// IsFork returns true if some versions of the module are served from the fork.
+func (m *ModuleProxy) IsFork(module string) bool {
+	return m.forkRule(module) != nil
+}
+
+func (m *ModuleProxy) forkRule(module string) *ForkRule {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, v := range m.forks {
+		if v.Module == module {
+			return v
+		}
+	}
+
+	return nil
+}
+
+// forkedVersion is the version of the fork which is served under the upstream module path.
+type forkedVersion struct {
+	rule    *ForkRule
+	root    *ModuleRoot
+	mod     *Module
+	version *ModuleVersion
+}
+
+// forkedVersions returns the versions of the fork which are served. The key is the version under the upstream module path.
+func (m *ModuleProxy) forkedVersions(ctx context.Context, module string) (map[string]*forkedVersion, error) {
+	rule := m.forkRule(module)
+	if rule == nil {
+		return nil, ErrNotForked
+	}
+	root, err := m.fetcher.Fetch(ctx, module)
+	if err != nil {
+		return nil, err
+	}
+	// The module in the root directory of the fork is substituted
+	var mod *Module
+	for _, v := range root.Modules {
+		if v.modFilePath == "go.mod" {
+			mod = v
+			break
+		}
+	}
+	if mod == nil {
+		return nil, xerrors.Newf("go.mod is not found in the root of %s", rule.Repository)
+	}
+
+	versions := make(map[string]*forkedVersion)
+	for _, v := range mod.Versions {
+		if !rule.contains(v.Semver) {
+			continue
+		}
+		versions[rule.forkVersion(v.Semver)] = &forkedVersion{rule: rule, root: root, mod: mod, version: v}
+	}
+
+	return versions, nil
+}
+
+// forkedVersion returns the version of the fork. The repository of the fork is fetched only if the version can be served from the fork.
+func (m *ModuleProxy) forkedVersion(ctx context.Context, module, version string) (*forkedVersion, error) {
+	rule := m.forkRule(module)
+	if rule == nil {
+		return nil, ErrNotForked
+	}
+	if _, ok := rule.tag(version); !ok {
+		return nil, ErrNotForked
+	}
+	versions, err := m.forkedVersions(ctx, module)
+	if err != nil {
+		return nil, err
+	}
+	v, ok := versions[version]
+	if !ok {
+		return nil, ErrNotForked
+	}
+
+	return v, nil
+}
+
+// ForkVersions returns the versions of the module which are served from the fork.
+func (m *ModuleProxy) ForkVersions(ctx context.Context, module string) ([]string, error) {
+	versions, err := m.forkedVersions(ctx, module)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []string
+	for k := range versions {
+		result = append(result, k)
+	}
+	semver.Sort(result)
+	return result, nil
+}
+
+// GetForkInfo returns .info of the version which is served from the fork. Info.Fork has the origin of the version.
+// If the version is not served from the fork, GetForkInfo returns ErrNotForked.
+func (m *ModuleProxy) GetForkInfo(ctx context.Context, module, version string) (Info, error) {
+	v, err := m.forkedVersion(ctx, module, version)
+	if err != nil {
+		return Info{}, err
+	}
+
+	return Info{
+		Version: version,
+		Time:    v.version.Time,
+		Fork:    &ForkInfo{Repository: v.rule.Repository, Tag: v.version.Version, Commit: v.version.Commit},
+	}, nil
+}
+
+// GetForkGoMod returns go.mod of the version which is served from the fork. The module path is rewritten to the upstream.
+// If the version is not served from the fork, GetForkGoMod returns ErrNotForked.
+func (m *ModuleProxy) GetForkGoMod(ctx context.Context, module, version string) (string, error) {
+	v, err := m.forkedVersion(ctx, module, version)
+	if err != nil {
+		return "", err
+	}
+	goMod, err := v.mod.ModuleFile(v.version.Semver)
+	if err != nil {
+		return "", err
+	}
+	goMod, err = rewriteModulePath(goMod, module)
+	if err != nil {
+		return "", err
+	}
+
+	return string(goMod), nil
+}
+
+// GetForkZip writes the zip of the version which is served from the fork.
+// The files are placed under the upstream module path and the module path of go.mod is rewritten.
+// If the version is not served from the fork, GetForkZip returns ErrNotForked.
+func (m *ModuleProxy) GetForkZip(ctx context.Context, w io.Writer, module, version string) error {
+	v, err := m.forkedVersion(ctx, module, version)
+	if err != nil {
+		return err
+	}
+
+	archive := func(w io.Writer) error {
+		var buf bytes.Buffer
+		if err := m.fetcher.Archive(ctx, &buf, v.mod.Path, v.version.Semver); err != nil {
+			return err
+		}
+		return rewriteModuleZip(w, buf.Bytes(), v.mod.Path+"@"+v.version.Semver+"/", module+"@"+version+"/", module)
+	}
+	if m.cache == nil {
+		return archive(w)
+	}
+
+	if !m.cache.Has(module, version, ArtifactZip) {
+		if err := m.cache.Put(module, version, ArtifactZip, archive); err != nil {
+			return err
+		}
+	}
+	f, err := m.cache.Open(module, version, ArtifactZip)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := io.Copy(w, f); err != nil {
+		return xerrors.WithStack(err)
+	}
+
+	return nil
+}
+
+// resolveForkRepoRoot returns the fork repository of the module. It returns nil if the module is not forked.
+func (m *ModuleProxy) resolveForkRepoRoot(module string) *vcs.RepoRoot {
+	rule := m.forkRule(module)
+	if rule == nil {
+		return nil
+	}
+
+	return &vcs.RepoRoot{VCS: vcs.ByCmd("git"), Repo: rule.Repository, Root: repoPathFromURL(rule.Repository)}
+}
+
+// rewriteModulePath replaces the module path of go.mod.
+func rewriteModulePath(goMod []byte, module string) ([]byte, error) {
+	f, err := modfile.ParseLax("go.mod", goMod, nil)
+	if err != nil {
+		return nil, xerrors.WithStack(err)
+	}
+	if err := f.AddModuleStmt(module); err != nil {
+		return nil, xerrors.WithStack(err)
+	}
+	buf, err := f.Format()
+	if err != nil {
+		return nil, xerrors.WithStack(err)
+	}
+
+	return buf, nil
+}
+
+// rewriteModuleZip copies the module zip with replacing the prefix of the files and the module path of go.mod.
+func rewriteModuleZip(w io.Writer, src []byte, oldPrefix, newPrefix, module string) error {
+	zr, err := zip.NewReader(bytes.NewReader(src), int64(len(src)))
+	if err != nil {
+		return xerrors.WithStack(err)
+	}
+
+	zw := zip.NewWriter(w)
+	for _, f := range zr.File {
+		name, ok := strings.CutPrefix(f.Name, oldPrefix)
+		if !ok {
+			return xerrors.Newf("unexpected file in the zip: %s", f.Name)
+		}
+		content, err := readZipFile(f)
+		if err != nil {
+			return err
+		}
+		if name == "go.mod" {
+			content, err = rewriteModulePath(content, module)
+			if err != nil {
+				return err
+			}
+		}
+		fw, err := zw.Create(newPrefix + name)
+		if err != nil {
+			return xerrors.WithStack(err)
+		}
+		if _, err := fw.Write(content); err != nil {
+			return xerrors.WithStack(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return xerrors.WithStack(err)
+	}
+
+	return nil
+}
@@ -0,0 +1,80 @@
+package gomodule
+
+import (
+	"archive/zip"
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestForkRule(t *testing.T) {
+	rule := &ForkRule{Module: "github.com/example/foo", Repository: "https://github.com/me/foo.git", MinVersion: "v0.9.0", MaxVersion: "v1.0.0"}
+	assert.True(t, rule.contains("v0.9.0"))
+	assert.True(t, rule.contains("v0.9.5-rc.1"))
+	assert.False(t, rule.contains("v0.8.0"))
+	assert.False(t, rule.contains("v1.0.0"))
+	assert.Equal(t, "v0.9.1-fork", rule.forkVersion("v0.9.1"))
+	assert.Equal(t, "v0.9.1-rc.1.fork", rule.forkVersion("v0.9.1-rc.1"))
+	for version, expect := range map[string]string{
+		"v0.9.1-fork":      "v0.9.1",
+		"v0.9.1-rc.1.fork": "v0.9.1-rc.1",
+		"v0.9.1":           "",
+		"v0.9.1-rc.1":      "",
+		"v0.9.1.fork":      "",
+		"v0.9.1-rc.1-fork": "",
+		"v1.0.0-fork":      "",
+		"v0.8.0-fork":      "",
+		"v0.9.1-patched":   "",
+		"latest":           "",
+	} {
+		tag, ok := rule.tag(version)
+		assert.Equal(t, expect != "", ok, version)
+		if ok {
+			assert.Equal(t, expect, tag)
+		}
+	}
+
+	rule = &ForkRule{Module: "github.com/example/bar", Repository: "https://github.com/me/bar", Suffix: "patched"}
+	assert.True(t, rule.contains("v2.0.0"))
+	assert.Equal(t, "v1.0.0-patched", rule.forkVersion("v1.0.0"))
+
+	proxy := NewModuleProxy(nil, t.TempDir(), 0, nil, nil, nil)
+	proxy.SetForks([]*ForkRule{rule})
+	assert.True(t, proxy.IsFork("github.com/example/bar"))
+	assert.False(t, proxy.IsFork("github.com/example/bar/v2"))
+	repoRoot, err := proxy.resolveRepoRoot("github.com/example/bar")
+	require.NoError(t, err)
+	assert.Equal(t, "github.com/me/bar", repoRoot.Root)
+	assert.Equal(t, "https://github.com/me/bar", repoRoot.Repo)
+}
+
+func TestRewriteModuleZip(t *testing.T) {
+	src := newTestModuleZip(t, "github.com/me/foo", "v1.0.0", map[string]string{
+		"go.mod":     "module github.com/me/foo\n\ngo 1.21\n\nrequire golang.org/x/mod v0.14.0\n",
+		"foo.go":     "package foo\n",
+		"bar/bar.go": "package bar\n",
+	})
+
+	var buf bytes.Buffer
+	err := rewriteModuleZip(&buf, src, "github.com/me/foo@v1.0.0/", "github.com/example/foo@v1.0.0-fork/", "github.com/example/foo")
+	require.NoError(t, err)
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	require.NoError(t, err)
+	files := make(map[string]string)
+	for _, f := range zr.File {
+		content, err := readZipFile(f)
+		require.NoError(t, err)
+		files[f.Name] = string(content)
+	}
+	assert.Len(t, files, 3)
+	assert.Equal(t, "package bar\n", files["github.com/example/foo@v1.0.0-fork/bar/bar.go"])
+	goMod := files["github.com/example/foo@v1.0.0-fork/go.mod"]
+	assert.Contains(t, goMod, "module github.com/example/foo\n")
+	assert.Contains(t, goMod, "require golang.org/x/mod v0.14.0")
+
+	err = rewriteModuleZip(&buf, src, "github.com/me/bar@v1.0.0/", "github.com/example/foo@v1.0.0-fork/", "github.com/example/foo")
+	assert.Error(t, err)
+}
@@ -0,0 +1,156 @@
+package gomodule
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.f110.dev/xerrors"
+)
+
+const readinessCheckTimeout = 5 * time.Second
+
+type HealthCheckFunc func(ctx context.Context) error
+
+type healthCheck struct {
+	Name  string
+	Check HealthCheckFunc
+}
+
+// HealthChecker serves the liveness and readiness probes.
+type HealthChecker struct {
+	checks       []healthCheck
+	shuttingDown atomic.Bool
+}
+
+func NewHealthChecker() *HealthChecker {
+	return &HealthChecker{}
+}
+
+func (h *HealthChecker) AddCheck(name string, fn HealthCheckFunc) {
+	h.checks = append(h.checks, healthCheck{Name: name, Check: fn})
+}
+
+// ShuttingDown makes the readiness probe fail so that the load balancer stops sending new requests.
+func (h *HealthChecker) ShuttingDown() {
+	h.shuttingDown.Store(true)
+}
+
+type checkResult struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+type readinessResponse struct {
+	Status string                 `json:"status"`
+	Checks map[string]checkResult `json:"checks,omitempty"`
+}
+
+func (h *HealthChecker) Liveness(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain")
+	w.Write([]byte("ok"))
+}
+
+func (h *HealthChecker) Readiness(w http.ResponseWriter, req *http.Request) {
+	if h.shuttingDown.Load() {
+		writeReadiness(w, http.StatusServiceUnavailable, readinessResponse{Status: "shutting_down"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(req.Context(), readinessCheckTimeout)
+	defer cancel()
+
+	res := readinessResponse{Status: "ok", Checks: make(map[string]checkResult)}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, v := range h.checks {
+		wg.Add(1)
+		go func(c healthCheck) {
+			defer wg.Done()
+
+			result := checkResult{Status: "ok"}
+			if err := c.Check(ctx); err != nil {
+				result = checkResult{Status: "fail", Error: err.Error()}
+			}
+			mu.Lock()
+			res.Checks[c.Name] = result
+			mu.Unlock()
+		}(v)
+	}
+	wg.Wait()
+
+	code := http.StatusOK
+	for _, v := range res.Checks {
+		if v.Status != "ok" {
+			res.Status = "fail"
+			code = http.StatusServiceUnavailable
+			break
+		}
+	}
+	writeReadiness(w, code, res)
+}
+
+func writeReadiness(w http.ResponseWriter, code int, res readinessResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(res)
+}
+
+// DirWritableCheck returns the check whether a file can be created in dir.
+// dir is created if it doesn't exist yet because it is created by the first fetch otherwise.
+func DirWritableCheck(dir string) HealthCheckFunc {
+	return func(_ context.Context) error {
+		if dir == "" {
+			return xerrors.New("the directory is not configured")
+		}
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return xerrors.WithStack(err)
+		}
+		f, err := os.CreateTemp(dir, ".readyz-")
+		if err != nil {
+			return xerrors.WithStack(err)
+		}
+		if err := f.Close(); err != nil {
+			return xerrors.WithStack(err)
+		}
+		if err := os.Remove(f.Name()); err != nil {
+			return xerrors.WithStack(err)
+		}
+
+		return nil
+	}
+}
+
+// UpstreamCheck returns the check whether the upstream module proxy responds.
+// Any response other than a server error is considered as reachable.
+func UpstreamCheck(upstream *url.URL) HealthCheckFunc {
+	client := &http.Client{Transport: &httpTransport{}}
+	return func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodHead, upstream.String(), nil)
+		if err != nil {
+			return xerrors.WithStack(err)
+		}
+		res, err := client.Do(req)
+		if err != nil {
+			return xerrors.WithStack(err)
+		}
+		res.Body.Close()
+		if res.StatusCode >= http.StatusInternalServerError {
+			return xerrors.Newf("upstream returns %s", res.Status)
+		}
+
+		return nil
+	}
+}
+
+// GitRemoteCheck returns the check whether the git remote of the module is reachable.
+func (m *ModuleProxy) GitRemoteCheck(module string) HealthCheckFunc {
+	return func(ctx context.Context) error {
+		return m.fetcher.Ping(ctx, module)
+	}
+}
@@ -0,0 +1,53 @@
+package gomodule
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.f110.dev/xerrors"
+)
+
+func TestHealthChecker(t *testing.T) {
+	h := NewHealthChecker()
+	h.AddCheck("mod_dir", DirWritableCheck(t.TempDir()))
+
+	rec := httptest.NewRecorder()
+	h.Readiness(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	// The directory which doesn't exist yet is created
+	missingDir := filepath.Join(t.TempDir(), "missing")
+	h.AddCheck("missing_dir", DirWritableCheck(missingDir))
+	notDir := filepath.Join(t.TempDir(), "file")
+	require.NoError(t, os.WriteFile(notDir, nil, 0644))
+	h.AddCheck("not_dir", DirWritableCheck(notDir))
+	h.AddCheck("empty_dir", DirWritableCheck(""))
+	h.AddCheck("always_fail", func(_ context.Context) error { return xerrors.New("fail") })
+	rec = httptest.NewRecorder()
+	h.Readiness(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	var res readinessResponse
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&res))
+	assert.Equal(t, "fail", res.Status)
+	assert.Equal(t, "ok", res.Checks["mod_dir"].Status)
+	assert.Equal(t, "ok", res.Checks["missing_dir"].Status)
+	assert.DirExists(t, missingDir)
+	assert.Equal(t, "fail", res.Checks["not_dir"].Status)
+	assert.Equal(t, "fail", res.Checks["empty_dir"].Status)
+	assert.Equal(t, "fail", res.Checks["always_fail"].Status)
+
+	h.ShuttingDown()
+	rec = httptest.NewRecorder()
+	h.Readiness(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	rec = httptest.NewRecorder()
+	h.Liveness(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
@@ -0,0 +1,241 @@
+package gomodule
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"go.f110.dev/xerrors"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
+)
+
+const (
+	indexDefaultLimit = 2000
+	indexMaxLimit     = 2000
+)
+
+// IndexEntry is the entry of the module index. The format is the same as index.golang.org.
+type IndexEntry struct {
+	Path      string
+	Version   string
+	Timestamp time.Time
+}
+
+// ModuleIndex is the feed of the versions which the proxy has observed.
+// The timestamp of the entry is the time when the version is observed first and is strictly increasing.
+// The entries are persisted to the file in JSON lines, so the feed is stable across restarts.
+type ModuleIndex struct {
+	mu      sync.Mutex
+	path    string
+	entries []IndexEntry
+	seen    map[module.Version]struct{}
+	// firstSeen is the timestamp of the first entry of each module.
+	firstSeen map[string]time.Time
+}
+
+// OpenModuleIndex reads the entries from the file. If the file doesn't exist, the index is empty.
+func OpenModuleIndex(path string) (*ModuleIndex, error) {
+	idx := &ModuleIndex{path: path, seen: make(map[module.Version]struct{}), firstSeen: make(map[string]time.Time)}
+
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return idx, nil
+	}
+	if err != nil {
+		return nil, xerrors.WithStack(err)
+	}
+	defer f.Close()
+
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		if len(s.Bytes()) == 0 {
+			continue
+		}
+		var e IndexEntry
+		if err := json.Unmarshal(s.Bytes(), &e); err != nil {
+			return nil, xerrors.Newf("%s: %w", path, err)
+		}
+		idx.entries = append(idx.entries, e)
+		idx.seen[module.Version{Path: e.Path, Version: e.Version}] = struct{}{}
+		if ts, ok := idx.firstSeen[e.Path]; !ok || e.Timestamp.Before(ts) {
+			idx.firstSeen[e.Path] = e.Timestamp
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, xerrors.WithStack(err)
+	}
+	sort.SliceStable(idx.entries, func(i, j int) bool { return idx.entries[i].Timestamp.Before(idx.entries[j].Timestamp) })
+
+	return idx, nil
+}
+
+// Add appends the versions which are not in the index yet and returns the added entries.
+func (i *ModuleIndex) Add(mods []module.Version) ([]IndexEntry, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	var last time.Time
+	if len(i.entries) > 0 {
+		last = i.entries[len(i.entries)-1].Timestamp
+	}
+	var added []IndexEntry
+	for _, v := range mods {
+		if _, ok := i.seen[v]; ok {
+			continue
+		}
+
+		ts := time.Now().UTC()
+		if !ts.After(last) {
+			ts = last.Add(time.Nanosecond)
+		}
+		last = ts
+		added = append(added, IndexEntry{Path: v.Path, Version: v.Version, Timestamp: ts})
+	}
+	if len(added) == 0 {
+		return nil, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(i.path), 0755); err != nil {
+		return nil, xerrors.WithStack(err)
+	}
+	f, err := os.OpenFile(i.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, xerrors.WithStack(err)
+	}
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for _, e := range added {
+		if err := enc.Encode(e); err != nil {
+			f.Close()
+			return nil, xerrors.WithStack(err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return nil, xerrors.WithStack(err)
+	}
+	if err := f.Close(); err != nil {
+		return nil, xerrors.WithStack(err)
+	}
+
+	for _, e := range added {
+		i.entries = append(i.entries, e)
+		i.seen[module.Version{Path: e.Path, Version: e.Version}] = struct{}{}
+		if _, ok := i.firstSeen[e.Path]; !ok {
+			i.firstSeen[e.Path] = e.Timestamp
+		}
+	}
+	return added, nil
+}
+
+// Observe adds the versions of the modules in the repository.
+func (i *ModuleIndex) Observe(root *ModuleRoot) ([]IndexEntry, error) {
+	var mods []module.Version
+	for _, m := range root.Modules {
+		for _, v := range m.Versions {
+			mods = append(mods, module.Version{Path: m.Path, Version: v.Semver})
+		}
+	}
+	sort.Slice(mods, func(i, j int) bool {
+		if mods[i].Path != mods[j].Path {
+			return mods[i].Path < mods[j].Path
+		}
+		return semver.Compare(mods[i].Version, mods[j].Version) < 0
+	})
+
+	return i.Add(mods)
+}
+
+// FirstSeen returns the timestamp when the module is observed first. If the module is not in the index, FirstSeen returns the zero time.
+func (i *ModuleIndex) FirstSeen(mod string) time.Time {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	return i.firstSeen[mod]
+}
+
+// Since returns the entries whose timestamp is equal to or after since in chronological order.
+// At most limit entries are returned. If filter is not nil, the entries which filter returns false are omitted.
+func (i *ModuleIndex) Since(since time.Time, limit int, filter func(IndexEntry) bool) []IndexEntry {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	n := sort.Search(len(i.entries), func(j int) bool { return !i.entries[j].Timestamp.Before(since) })
+	var result []IndexEntry
+	for _, e := range i.entries[n:] {
+		if len(result) >= limit {
+			break
+		}
+		if filter != nil && !filter(e) {
+			continue
+		}
+		result = append(result, e)
+	}
+
+	return result
+}
+
+// IndexHandler serves the module index like index.golang.org.
+//
+//	GET /index?since=2019-04-10T19:08:52.997264Z&limit=10
+//
+// The response is newline-delimited JSON of IndexEntry. The modules which the client can not access are omitted.
+type IndexHandler struct {
+	index  *ModuleIndex
+	proxy  *ModuleProxy
+	auth   *Authenticator
+	logger logr.Logger
+}
+
+// NewIndexHandler returns IndexHandler. If auth is nil, the clients are not authenticated.
+func NewIndexHandler(index *ModuleIndex, proxy *ModuleProxy, auth *Authenticator, logger logr.Logger) *IndexHandler {
+	return &IndexHandler{index: index, proxy: proxy, auth: auth, logger: logger}
+}
+
+func (h *IndexHandler) Handler() http.Handler {
+	return middlewareBrowserAuth(h.auth)(http.HandlerFunc(h.serve))
+}
+
+func (h *IndexHandler) serve(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var since time.Time
+	if v := req.URL.Query().Get("since"); v != "" {
+		t, err := time.Parse(time.RFC3339Nano, v)
+		if err != nil {
+			http.Error(w, "malformed since", http.StatusBadRequest)
+			return
+		}
+		since = t
+	}
+	limit := indexDefaultLimit
+	if v := req.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			http.Error(w, "malformed limit", http.StatusBadRequest)
+			return
+		}
+		limit = min(n, indexMaxLimit)
+	}
+
+	id := IdentityFromContext(req.Context())
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	enc := json.NewEncoder(w)
+	entries := h.index.Since(since, limit, func(e IndexEntry) bool { return h.proxy.IsAllowed(e.Path, id) })
+	for _, e := range entries {
+		if err := enc.Encode(e); err != nil {
+			h.logger.Info("Failed to write the index", xerrors.ZapField(err))
+			return
+		}
+	}
+}
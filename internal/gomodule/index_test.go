@@ -0,0 +1,76 @@
+package gomodule
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/mod/module"
+)
+
+func TestModuleIndex(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "index.jsonl")
+	idx, err := OpenModuleIndex(path)
+	require.NoError(t, err)
+
+	added, err := idx.Observe(&ModuleRoot{Modules: []*Module{
+		{Path: "example.com/foo", Versions: []*ModuleVersion{{Version: "v1.0.0", Semver: "v1.0.0"}, {Version: "v1.1.0", Semver: "v1.1.0"}}},
+		{Path: "example.com/secret", Versions: []*ModuleVersion{{Version: "v0.1.0", Semver: "v0.1.0"}}},
+	}})
+	require.NoError(t, err)
+	require.Len(t, added, 3)
+	assert.True(t, added[0].Timestamp.Before(added[1].Timestamp))
+	// The observed version is not added again
+	added, err = idx.Add([]module.Version{{Path: "example.com/foo", Version: "v1.0.0"}, {Path: "example.com/foo", Version: "v1.2.0"}})
+	require.NoError(t, err)
+	require.Len(t, added, 1)
+	assert.Equal(t, "v1.2.0", added[0].Version)
+	// The timestamp of the first observation of the module is kept
+	firstSeen := idx.FirstSeen("example.com/foo")
+	assert.False(t, firstSeen.IsZero())
+	assert.True(t, firstSeen.Before(added[0].Timestamp))
+	assert.True(t, idx.FirstSeen("example.com/unknown").IsZero())
+
+	// The entries are persisted
+	idx, err = OpenModuleIndex(path)
+	require.NoError(t, err)
+	entries := idx.Since(time.Time{}, 10, nil)
+	require.Len(t, entries, 4)
+	assert.Equal(t, "example.com/foo", entries[0].Path)
+	assert.Equal(t, "v1.2.0", entries[3].Version)
+	assert.Len(t, idx.Since(entries[2].Timestamp, 10, nil), 2)
+	assert.Len(t, idx.Since(time.Time{}, 1, nil), 1)
+	assert.Equal(t, firstSeen, idx.FirstSeen("example.com/foo"))
+
+	auth, err := NewAuthenticator([]BearerToken{{Name: "bob", Token: "bob-token"}}, nil, nil, nil, false)
+	require.NoError(t, err)
+	proxy := NewModuleProxy([]*ModuleRule{
+		{Match: regexp.MustCompile(`^example.com/foo`)},
+		{Match: regexp.MustCompile(`^example.com/secret`), AllowedUsers: []string{"alice"}},
+	}, t.TempDir(), 0, nil, nil, nil)
+	handler := NewIndexHandler(idx, proxy, auth, logr.Discard()).Handler()
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/index", nil))
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	req := httptest.NewRequest(http.MethodGet, "/index?since="+entries[0].Timestamp.Format(time.RFC3339Nano), nil)
+	req.Header.Set("Authorization", "Bearer bob-token")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+	lines := strings.Split(strings.TrimSpace(rec.Body.String()), "\n")
+	// The module which the client can not access is omitted
+	require.Len(t, lines, 3)
+	var e IndexEntry
+	require.NoError(t, json.Unmarshal([]byte(lines[2]), &e))
+	assert.Equal(t, IndexEntry{Path: "example.com/foo", Version: "v1.2.0", Timestamp: entries[3].Timestamp}, e)
+}
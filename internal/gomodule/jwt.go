@@ -0,0 +1,265 @@
+package gomodule
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/go-jose/go-jose/v4/jwt"
+	"go.f110.dev/xerrors"
+)
+
+const (
+	jwksCacheDuration      = 1 * time.Hour
+	jwksMinRefreshInterval = 1 * time.Minute
+)
+
+var jwtSignatureAlgorithms = []jose.SignatureAlgorithm{
+	jose.RS256, jose.RS384, jose.RS512,
+	jose.PS256, jose.PS384, jose.PS512,
+	jose.ES256, jose.ES384, jose.ES512,
+	jose.EdDSA,
+}
+
+// JWTIssuer is the issuer of JWT which is trusted.
+type JWTIssuer struct {
+	// Issuer matches the "iss" claim exactly.
+	Issuer string
+	// Audiences are the accepted values of the "aud" claim. It is required because the shared issuer
+	// (e.g. GitHub Actions) signs the tokens for any audience.
+	Audiences []string
+	// JWKSURL is the URL of JWK Set. If both JWKSURL and JWKSFile are empty, the URL is discovered by OpenID Connect Discovery.
+	JWKSURL string
+	// JWKSFile is the path to the file of JWK Set.
+	JWKSFile string
+	// UsernameClaim is the claim which is used as the name of the identity. The default is "sub".
+	// The name is prefixed with the issuer (e.g. "https://issuer.example.com|alice") so that it never collides with the other credentials.
+	UsernameClaim string
+	// GroupsClaim is the claim which is used as the groups of the identity. The value of the claim should be a string or an array of strings.
+	GroupsClaim string
+	// ClaimGroups adds the group to the identity when the claim has the value.
+	ClaimGroups []JWTClaimGroup
+}
+
+type JWTClaimGroup struct {
+	Claim string
+	Value string
+	Group string
+}
+
+// JWTVerifier verifies JWT which is issued by the trusted issuers and maps the claims to Identity.
+type JWTVerifier struct {
+	issuers    map[string]*jwtIssuer
+	httpClient *http.Client
+}
+
+type jwtIssuer struct {
+	JWTIssuer
+
+	mu          sync.Mutex
+	keys        *jose.JSONWebKeySet
+	fetchedAt   time.Time
+	lastRefresh time.Time
+}
+
+func NewJWTVerifier(issuers []JWTIssuer) (*JWTVerifier, error) {
+	v := &JWTVerifier{
+		issuers:    make(map[string]*jwtIssuer),
+		httpClient: &http.Client{Transport: &httpTransport{}, Timeout: 10 * time.Second},
+	}
+	for _, iss := range issuers {
+		if iss.Issuer == "" {
+			return nil, xerrors.New("issuer is required")
+		}
+		if len(iss.Audiences) == 0 {
+			return nil, xerrors.Newf("audiences of %s are required", iss.Issuer)
+		}
+		if iss.UsernameClaim == "" {
+			iss.UsernameClaim = "sub"
+		}
+		i := &jwtIssuer{JWTIssuer: iss}
+		if iss.JWKSFile != "" {
+			keys, err := readJWKSFile(iss.JWKSFile)
+			if err != nil {
+				return nil, err
+			}
+			i.keys = keys
+		}
+		v.issuers[iss.Issuer] = i
+	}
+
+	return v, nil
+}
+
+// IsJWT returns true if the token looks like JWS compact serialization.
+func IsJWT(token string) bool {
+	return strings.Count(token, ".") == 2
+}
+
+func (v *JWTVerifier) Verify(ctx context.Context, token string) (*Identity, error) {
+	tok, err := jwt.ParseSigned(token, jwtSignatureAlgorithms)
+	if err != nil {
+		return nil, xerrors.WithStack(err)
+	}
+	var unverified jwt.Claims
+	if err := tok.UnsafeClaimsWithoutVerification(&unverified); err != nil {
+		return nil, xerrors.WithStack(err)
+	}
+	iss, ok := v.issuers[unverified.Issuer]
+	if !ok {
+		return nil, xerrors.Newf("issuer %s is not trusted", unverified.Issuer)
+	}
+
+	keys, err := v.keySet(ctx, iss, false)
+	if err != nil {
+		return nil, err
+	}
+	var claims jwt.Claims
+	rawClaims := make(map[string]interface{})
+	err = tok.Claims(keys, &claims, &rawClaims)
+	if errors.Is(err, jose.ErrJWKSKidNotFound) && iss.JWKSFile == "" {
+		// The keys may be rotated
+		keys, err = v.keySet(ctx, iss, true)
+		if err != nil {
+			return nil, err
+		}
+		err = tok.Claims(keys, &claims, &rawClaims)
+	}
+	if err != nil {
+		return nil, xerrors.WithStack(err)
+	}
+	if err := claims.Validate(jwt.Expected{Issuer: iss.Issuer, AnyAudience: iss.Audiences, Time: time.Now()}); err != nil {
+		return nil, xerrors.WithStack(err)
+	}
+
+	name, ok := rawClaims[iss.UsernameClaim].(string)
+	if !ok || name == "" {
+		return nil, xerrors.Newf("claim %s is not found", iss.UsernameClaim)
+	}
+	id := &Identity{Name: jwtIdentityName(iss.Issuer, name)}
+	if iss.GroupsClaim != "" {
+		id.Groups = append(id.Groups, claimStrings(rawClaims[iss.GroupsClaim])...)
+	}
+	for _, g := range iss.ClaimGroups {
+		for _, val := range claimStrings(rawClaims[g.Claim]) {
+			if val == g.Value {
+				id.Groups = append(id.Groups, g.Group)
+				break
+			}
+		}
+	}
+	sort.Strings(id.Groups)
+
+	return id, nil
+}
+
+// jwtIdentityName returns the name of the identity which is namespaced by the issuer.
+func jwtIdentityName(issuer, name string) string {
+	return issuer + "|" + name
+}
+
+func (v *JWTVerifier) keySet(ctx context.Context, iss *jwtIssuer, refresh bool) (*jose.JSONWebKeySet, error) {
+	iss.mu.Lock()
+	defer iss.mu.Unlock()
+
+	if iss.JWKSFile != "" {
+		return iss.keys, nil
+	}
+	if iss.keys != nil && time.Since(iss.fetchedAt) < jwksCacheDuration {
+		if !refresh || time.Since(iss.lastRefresh) < jwksMinRefreshInterval {
+			return iss.keys, nil
+		}
+	}
+
+	jwksURL := iss.JWKSURL
+	if jwksURL == "" {
+		u, err := v.discoverJWKSURL(ctx, iss.Issuer)
+		if err != nil {
+			return nil, err
+		}
+		jwksURL = u
+	}
+	keys := &jose.JSONWebKeySet{}
+	if err := v.getJSON(ctx, jwksURL, keys); err != nil {
+		return nil, err
+	}
+	iss.keys = keys
+	iss.fetchedAt = time.Now()
+	if refresh {
+		iss.lastRefresh = iss.fetchedAt
+	}
+
+	return keys, nil
+}
+
+func (v *JWTVerifier) discoverJWKSURL(ctx context.Context, issuer string) (string, error) {
+	var conf struct {
+		JWKSURI string `json:"jwks_uri"`
+	}
+	if err := v.getJSON(ctx, strings.TrimSuffix(issuer, "/")+"/.well-known/openid-configuration", &conf); err != nil {
+		return "", err
+	}
+	if conf.JWKSURI == "" {
+		return "", xerrors.Newf("jwks_uri is not found in the configuration of %s", issuer)
+	}
+
+	return conf.JWKSURI, nil
+}
+
+func (v *JWTVerifier) getJSON(ctx context.Context, u string, dst interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return xerrors.WithStack(err)
+	}
+	res, err := v.httpClient.Do(req)
+	if err != nil {
+		return xerrors.WithStack(err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return xerrors.Newf("%s returns %s", u, res.Status)
+	}
+	if err := json.NewDecoder(res.Body).Decode(dst); err != nil {
+		return xerrors.WithStack(err)
+	}
+
+	return nil
+}
+
+func readJWKSFile(path string) (*jose.JSONWebKeySet, error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, xerrors.WithStack(err)
+	}
+	keys := &jose.JSONWebKeySet{}
+	if err := json.Unmarshal(buf, keys); err != nil {
+		return nil, xerrors.WithStack(err)
+	}
+
+	return keys, nil
+}
+
+func claimStrings(v interface{}) []string {
+	switch val := v.(type) {
+	case string:
+		return []string{val}
+	case []interface{}:
+		var s []string
+		for _, e := range val {
+			s = append(s, fmt.Sprint(e))
+		}
+		return s
+	case nil:
+		return nil
+	default:
+		return []string{fmt.Sprint(val)}
+	}
+}
@@ -0,0 +1,131 @@
+package gomodule
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/go-jose/go-jose/v4/jwt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestJWKS returns the JWK Set file and the function which signs the claims by the key of the set.
+func newTestJWKS(t *testing.T) (string, func(t *testing.T, claims jwt.Claims, extra map[string]interface{}) string) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	jwks := jose.JSONWebKeySet{Keys: []jose.JSONWebKey{
+		{Key: privateKey.Public(), KeyID: "test", Algorithm: string(jose.RS256), Use: "sig"},
+	}}
+	buf, err := json.Marshal(jwks)
+	require.NoError(t, err)
+	jwksFile := filepath.Join(t.TempDir(), "jwks.json")
+	require.NoError(t, os.WriteFile(jwksFile, buf, 0644))
+
+	signer, err := jose.NewSigner(
+		jose.SigningKey{Algorithm: jose.RS256, Key: privateKey},
+		(&jose.SignerOptions{}).WithType("JWT").WithHeader("kid", "test"),
+	)
+	require.NoError(t, err)
+	return jwksFile, func(t *testing.T, claims jwt.Claims, extra map[string]interface{}) string {
+		token, err := jwt.Signed(signer).Claims(claims).Claims(extra).Serialize()
+		require.NoError(t, err)
+		return token
+	}
+}
+
+func TestJWTVerifier(t *testing.T) {
+	jwksFile, sign := newTestJWKS(t)
+
+	v, err := NewJWTVerifier([]JWTIssuer{
+		{
+			Issuer:        "https://token.actions.githubusercontent.com",
+			Audiences:     []string{"gomodule-proxy"},
+			JWKSFile:      jwksFile,
+			UsernameClaim: "repository",
+			ClaimGroups:   []JWTClaimGroup{{Claim: "repository_owner", Value: "f110", Group: "ci"}},
+		},
+	})
+	require.NoError(t, err)
+
+	_, err = NewJWTVerifier([]JWTIssuer{{Issuer: "https://token.actions.githubusercontent.com", JWKSFile: jwksFile}})
+	assert.Error(t, err, "the issuer without audiences has to be rejected")
+
+	now := time.Now()
+	claims := jwt.Claims{
+		Issuer:   "https://token.actions.githubusercontent.com",
+		Subject:  "repo:f110/gomodule-proxy:ref:refs/heads/master",
+		Audience: jwt.Audience{"gomodule-proxy"},
+		IssuedAt: jwt.NewNumericDate(now),
+		Expiry:   jwt.NewNumericDate(now.Add(5 * time.Minute)),
+	}
+	id, err := v.Verify(context.Background(), sign(t, claims, map[string]interface{}{
+		"repository":       "f110/gomodule-proxy",
+		"repository_owner": "f110",
+	}))
+	require.NoError(t, err)
+	assert.Equal(t, "https://token.actions.githubusercontent.com|f110/gomodule-proxy", id.Name)
+	assert.Equal(t, []string{"ci"}, id.Groups)
+
+	expired := claims
+	expired.Expiry = jwt.NewNumericDate(now.Add(-5 * time.Minute))
+	_, err = v.Verify(context.Background(), sign(t, expired, map[string]interface{}{"repository": "f110/gomodule-proxy"}))
+	assert.Error(t, err)
+
+	wrongAudience := claims
+	wrongAudience.Audience = jwt.Audience{"other"}
+	_, err = v.Verify(context.Background(), sign(t, wrongAudience, map[string]interface{}{"repository": "f110/gomodule-proxy"}))
+	assert.Error(t, err)
+
+	untrusted := claims
+	untrusted.Issuer = "https://example.com"
+	_, err = v.Verify(context.Background(), sign(t, untrusted, map[string]interface{}{"repository": "f110/gomodule-proxy"}))
+	assert.Error(t, err)
+}
+
+func TestAuthenticator_JWT(t *testing.T) {
+	jwksFile, sign := newTestJWKS(t)
+	const issuer = "https://token.actions.githubusercontent.com"
+	v, err := NewJWTVerifier([]JWTIssuer{{Issuer: issuer, Audiences: []string{"gomodule-proxy"}, JWKSFile: jwksFile}})
+	require.NoError(t, err)
+
+	// The static user and the subject of the token have the same name
+	a, err := NewAuthenticator(
+		[]BearerToken{{Name: "alice", Token: "static-token"}},
+		nil,
+		map[string][]string{"admin": {"alice"}, "ci": {issuer + "|alice"}},
+		v,
+		false,
+	)
+	require.NoError(t, err)
+
+	now := time.Now()
+	token := sign(t, jwt.Claims{
+		Issuer:   issuer,
+		Subject:  "alice",
+		Audience: jwt.Audience{"gomodule-proxy"},
+		IssuedAt: jwt.NewNumericDate(now),
+		Expiry:   jwt.NewNumericDate(now.Add(5 * time.Minute)),
+	}, nil)
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	id, err := a.Authenticate(req)
+	require.NoError(t, err)
+	assert.Equal(t, issuer+"|alice", id.Name)
+	assert.Equal(t, []string{"ci"}, id.Groups)
+	assert.False(t, (&ModuleRule{AllowedUsers: []string{"alice"}}).IsAllowed(id))
+
+	req.Header.Set("Authorization", "Bearer static-token")
+	id, err = a.Authenticate(req)
+	require.NoError(t, err)
+	assert.Equal(t, "alice", id.Name)
+	assert.Equal(t, []string{"admin"}, id.Groups)
+}
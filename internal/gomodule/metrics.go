@@ -0,0 +1,147 @@
+package gomodule
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const metricsNamespace = "gomodule_proxy"
+
+const (
+	routePrivate  = "private"
+	routeUpstream = "upstream"
+)
+
+// Metrics holds the collectors of the proxy.
+// All methods are safe to call on a nil receiver so that the metrics can be omitted in tests.
+type Metrics struct {
+	registry *prometheus.Registry
+
+	requestsTotal    *prometheus.CounterVec
+	requestDuration  *prometheus.HistogramVec
+	requestsInFlight prometheus.Gauge
+	zipBytesServed   *prometheus.CounterVec
+	gitFetchDuration *prometheus.HistogramVec
+	gitFetchFailures *prometheus.CounterVec
+	cacheRequests    *prometheus.CounterVec
+}
+
+func NewMetrics() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		requestsTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "http_requests_total",
+			Help:      "The number of requests per endpoint, route and status code",
+		}, []string{"endpoint", "route", "code"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "The latency of requests per endpoint and route",
+			Buckets:   []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60},
+		}, []string{"endpoint", "route"}),
+		requestsInFlight: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "http_requests_in_flight",
+			Help:      "The number of requests currently being served",
+		}),
+		zipBytesServed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "zip_bytes_served_total",
+			Help:      "The total bytes of module zip served per route",
+		}, []string{"route"}),
+		gitFetchDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "git_fetch_duration_seconds",
+			Help:      "The duration of cloning or fetching a repository",
+			Buckets:   []float64{0.1, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300},
+		}, []string{"repository"}),
+		gitFetchFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "git_fetch_failures_total",
+			Help:      "The number of failures of cloning or fetching a repository",
+		}, []string{"repository"}),
+		cacheRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "cache_requests_total",
+			Help:      "The number of lookups of the local repository cache",
+		}, []string{"result"}),
+	}
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.requestsTotal,
+		m.requestDuration,
+		m.requestsInFlight,
+		m.zipBytesServed,
+		m.gitFetchDuration,
+		m.gitFetchFailures,
+		m.cacheRequests,
+	)
+
+	return m
+}
+
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{Registry: m.registry})
+}
+
+func (m *Metrics) ObserveRequest(endpoint, route string, code int, d time.Duration) {
+	if m == nil {
+		return
+	}
+
+	m.requestsTotal.WithLabelValues(endpoint, route, strconv.Itoa(code)).Inc()
+	m.requestDuration.WithLabelValues(endpoint, route).Observe(d.Seconds())
+}
+
+func (m *Metrics) IncInFlight() {
+	if m == nil {
+		return
+	}
+	m.requestsInFlight.Inc()
+}
+
+func (m *Metrics) DecInFlight() {
+	if m == nil {
+		return
+	}
+	m.requestsInFlight.Dec()
+}
+
+func (m *Metrics) AddZipBytes(route string, n int64) {
+	if m == nil {
+		return
+	}
+	m.zipBytesServed.WithLabelValues(route).Add(float64(n))
+}
+
+func (m *Metrics) ObserveGitFetch(repository string, d time.Duration, err error) {
+	if m == nil {
+		return
+	}
+
+	m.gitFetchDuration.WithLabelValues(repository).Observe(d.Seconds())
+	if err != nil {
+		m.gitFetchFailures.WithLabelValues(repository).Inc()
+	}
+}
+
+func (m *Metrics) CacheHit() {
+	if m == nil {
+		return
+	}
+	m.cacheRequests.WithLabelValues("hit").Inc()
+}
+
+func (m *Metrics) CacheMiss() {
+	if m == nil {
+		return
+	}
+	m.cacheRequests.WithLabelValues("miss").Inc()
+}
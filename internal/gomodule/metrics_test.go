@@ -0,0 +1,94 @@
+package gomodule
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.f110.dev/xerrors"
+)
+
+func TestMetrics(t *testing.T) {
+	m := NewMetrics()
+	m.IncInFlight()
+	m.IncInFlight()
+	m.DecInFlight()
+	m.ObserveRequest("zip", routePrivate, http.StatusOK, time.Second)
+	m.ObserveRequest("zip", routePrivate, http.StatusOK, time.Second)
+	m.ObserveRequest("info", routeUpstream, http.StatusNotFound, time.Second)
+	m.AddZipBytes(routePrivate, 100)
+	m.ObserveGitFetch("example.com/foo", time.Second, nil)
+	m.ObserveGitFetch("example.com/foo", time.Second, xerrors.New("failed"))
+	m.CacheHit()
+	m.CacheMiss()
+	m.CacheMiss()
+
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.requestsInFlight))
+	assert.Equal(t, float64(2), testutil.ToFloat64(m.requestsTotal.WithLabelValues("zip", routePrivate, "200")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.requestsTotal.WithLabelValues("info", routeUpstream, "404")))
+	assert.Equal(t, 2, testutil.CollectAndCount(m.requestDuration))
+	assert.Equal(t, float64(100), testutil.ToFloat64(m.zipBytesServed.WithLabelValues(routePrivate)))
+	assert.Equal(t, 1, testutil.CollectAndCount(m.gitFetchDuration))
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.gitFetchFailures.WithLabelValues("example.com/foo")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.cacheRequests.WithLabelValues("hit")))
+	assert.Equal(t, float64(2), testutil.ToFloat64(m.cacheRequests.WithLabelValues("miss")))
+
+	// All methods can be called on nil
+	var nilMetrics *Metrics
+	assert.NotPanics(t, func() {
+		nilMetrics.IncInFlight()
+		nilMetrics.DecInFlight()
+		nilMetrics.ObserveRequest("zip", routePrivate, http.StatusOK, time.Second)
+		nilMetrics.AddZipBytes(routePrivate, 100)
+		nilMetrics.ObserveGitFetch("example.com/foo", time.Second, nil)
+		nilMetrics.CacheHit()
+		nilMetrics.CacheMiss()
+	})
+}
+
+func TestResponseWriter(t *testing.T) {
+	rec := httptest.NewRecorder()
+	rw := newResponseWriter(rec)
+	_, err := rw.Write([]byte("foo"))
+	require.NoError(t, err)
+	_, err = rw.Write([]byte("bar"))
+	require.NoError(t, err)
+	rw.Flush()
+	// The status code is 200 if WriteHeader is not called
+	assert.Equal(t, http.StatusOK, rw.status)
+	assert.Equal(t, int64(6), rw.written)
+	assert.True(t, rec.Flushed)
+	assert.Equal(t, rec, rw.Unwrap())
+
+	rec = httptest.NewRecorder()
+	rw = newResponseWriter(rec)
+	rw.WriteHeader(http.StatusNotFound)
+	assert.Equal(t, http.StatusNotFound, rw.status)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Equal(t, int64(0), rw.written)
+}
+
+func TestProxyServer_Metrics(t *testing.T) {
+	upstream := newTestUpstream(t, map[string]string{"example.com/public@v1.0.0": "module example.com/public\n"})
+	proxy := NewModuleProxy([]*ModuleRule{{Match: regexp.MustCompile(`^example.com/private`)}}, t.TempDir(), 0, nil, nil, nil)
+	m := NewMetrics()
+	s := NewProxyServer("", nil, ServerTimeouts{}, []*url.URL{upstream}, proxy, nil, m, nil, AccessLogFormatLogger, logr.Discard(), false)
+
+	rec := getTestProxyServer(s, "/example.com/public/@v/v1.0.0.zip")
+	require.Equal(t, http.StatusOK, rec.Code)
+	zipSize := rec.Body.Len()
+	rec = getTestProxyServer(s, "/example.com/public/@v/v2.0.0.info")
+	require.Equal(t, http.StatusNotFound, rec.Code)
+
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.requestsTotal.WithLabelValues("zip", routeUpstream, "200")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.requestsTotal.WithLabelValues("info", routeUpstream, "404")))
+	assert.Equal(t, float64(zipSize), testutil.ToFloat64(m.zipBytesServed.WithLabelValues(routeUpstream)))
+	assert.Equal(t, float64(0), testutil.ToFloat64(m.requestsInFlight))
+}
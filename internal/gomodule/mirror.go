@@ -0,0 +1,105 @@
+package gomodule
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+
+	"go.f110.dev/xerrors"
+	"golang.org/x/mod/semver"
+)
+
+// MirrorResult is the result of mirroring the module.
+type MirrorResult struct {
+	Module string
+	// Added is the versions which are written in this run.
+	Added []string
+	// Latest is the version which @latest points to.
+	Latest string
+}
+
+// Mirror writes all versions of the module into the directory in GOPROXY layout.
+// The version which has already been mirrored is skipped, so the subsequent run writes only the new versions.
+// @v/list and @latest are always rewritten.
+func Mirror(ctx context.Context, proxy *ModuleProxy, out *ArtifactCache, mod string) (*MirrorResult, error) {
+	ctx, span := tracer.Start(ctx, "Mirror")
+	defer span.End()
+
+	versions, err := proxy.Versions(ctx, mod)
+	if err != nil {
+		return nil, err
+	}
+	result := &MirrorResult{Module: mod}
+	if len(versions) == 0 {
+		return result, nil
+	}
+
+	for _, ver := range versions {
+		// .zip is written last, so the version which has .zip is complete
+		if out.Has(mod, ver, ArtifactZip) {
+			continue
+		}
+
+		info, err := proxy.GetInfo(ctx, mod, ver)
+		if err != nil {
+			return nil, err
+		}
+		err = out.Put(mod, ver, ArtifactInfo, func(w io.Writer) error {
+			return xerrors.WithStack(json.NewEncoder(w).Encode(info))
+		})
+		if err != nil {
+			return nil, err
+		}
+		goMod, err := proxy.GetGoMod(ctx, mod, ver)
+		if err != nil {
+			return nil, err
+		}
+		err = out.Put(mod, ver, ArtifactMod, func(w io.Writer) error {
+			_, err := io.WriteString(w, goMod)
+			return xerrors.WithStack(err)
+		})
+		if err != nil {
+			return nil, err
+		}
+		err = out.Put(mod, ver, ArtifactZip, func(w io.Writer) error {
+			return proxy.GetZip(ctx, w, mod, ver)
+		})
+		if err != nil {
+			return nil, err
+		}
+		result.Added = append(result.Added, ver)
+	}
+
+	if err := out.PutList(mod, versions); err != nil {
+		return nil, err
+	}
+	result.Latest = latestVersion(versions)
+	info, err := proxy.GetInfo(ctx, mod, result.Latest)
+	if err != nil {
+		return nil, err
+	}
+	if err := out.PutLatest(mod, info); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// latestVersion returns the highest release version. If there is no release version, the highest pre-release version is returned.
+func latestVersion(versions []string) string {
+	var latest, latestPrerelease string
+	for _, v := range versions {
+		if semver.Prerelease(v) == "" {
+			if semver.Compare(v, latest) > 0 {
+				latest = v
+			}
+		} else if semver.Compare(v, latestPrerelease) > 0 {
+			latestPrerelease = v
+		}
+	}
+	if latest != "" {
+		return latest
+	}
+
+	return latestPrerelease
+}
@@ -0,0 +1,88 @@
+package gomodule
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMirror(t *testing.T) {
+	// The upper case letter of the module path is escaped in the output
+	repoDir := newTestGitRepository(t, map[string]string{
+		"go.mod": "module example.com/Foo\n",
+		"foo.go": "package foo\n",
+	}, "v1.0.0", "v1.1.0-rc.1")
+	proxy := NewModuleProxy([]*ModuleRule{
+		{Match: regexp.MustCompile(`^example\.com/Foo(/|$)`), Repository: repoDir, Prefix: "example.com/Foo"},
+	}, t.TempDir(), 0, nil, nil, nil)
+	outDir := t.TempDir()
+	out := NewArtifactCache(outDir)
+
+	result, err := Mirror(context.Background(), proxy, out, "example.com/Foo")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"v1.0.0", "v1.1.0-rc.1"}, result.Added)
+	// The release version takes precedence over the pre-release version
+	assert.Equal(t, "v1.0.0", result.Latest)
+	for _, v := range []string{"v1.0.0.info", "v1.0.0.mod", "v1.0.0.zip", "v1.1.0-rc.1.info", "v1.1.0-rc.1.mod", "v1.1.0-rc.1.zip"} {
+		assert.FileExists(t, filepath.Join(outDir, "example.com/!foo/@v", v))
+	}
+	buf, err := os.ReadFile(filepath.Join(outDir, "example.com/!foo/@v/list"))
+	require.NoError(t, err)
+	assert.Equal(t, "v1.0.0\nv1.1.0-rc.1\n", string(buf))
+	buf, err = os.ReadFile(filepath.Join(outDir, "example.com/!foo/@latest"))
+	require.NoError(t, err)
+	var latest Info
+	require.NoError(t, json.Unmarshal(buf, &latest))
+	assert.Equal(t, "v1.0.0", latest.Version)
+
+	// The version which has been mirrored is not written again
+	err = os.WriteFile(filepath.Join(outDir, "example.com/!foo/@v/v1.0.0.mod"), []byte("mirrored"), 0644)
+	require.NoError(t, err)
+	repo, err := git.PlainOpen(repoDir)
+	require.NoError(t, err)
+	wt, err := repo.Worktree()
+	require.NoError(t, err)
+	err = os.WriteFile(filepath.Join(repoDir, "bar.go"), []byte("package foo\n"), 0644)
+	require.NoError(t, err)
+	_, err = wt.Add("bar.go")
+	require.NoError(t, err)
+	commitHash, err := wt.Commit("add bar", &git.CommitOptions{
+		Author: &object.Signature{Email: "test@example.com", When: time.Now()},
+	})
+	require.NoError(t, err)
+	_, err = repo.CreateTag("v1.1.0", commitHash, &git.CreateTagOptions{
+		Tagger:  &object.Signature{Email: "test@example.com", When: time.Now()},
+		Message: "v1.1.0",
+	})
+	require.NoError(t, err)
+
+	result, err = Mirror(context.Background(), proxy, out, "example.com/Foo")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"v1.1.0"}, result.Added)
+	assert.Equal(t, "v1.1.0", result.Latest)
+	buf, err = os.ReadFile(filepath.Join(outDir, "example.com/!foo/@v/v1.0.0.mod"))
+	require.NoError(t, err)
+	assert.Equal(t, "mirrored", string(buf))
+	buf, err = os.ReadFile(filepath.Join(outDir, "example.com/!foo/@v/list"))
+	require.NoError(t, err)
+	assert.Equal(t, "v1.0.0\nv1.1.0-rc.1\nv1.1.0\n", string(buf))
+	buf, err = os.ReadFile(filepath.Join(outDir, "example.com/!foo/@latest"))
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(buf, &latest))
+	assert.Equal(t, "v1.1.0", latest.Version)
+}
+
+func TestLatestVersion(t *testing.T) {
+	assert.Equal(t, "v1.2.0", latestVersion([]string{"v1.0.0", "v1.2.0", "v1.3.0-rc.1", "v1.1.0"}))
+	assert.Equal(t, "v0.2.0-beta", latestVersion([]string{"v0.1.0-alpha", "v0.2.0-beta"}))
+	assert.Equal(t, "", latestVersion(nil))
+}
@@ -0,0 +1,201 @@
+package gomodule
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"go.f110.dev/xerrors"
+)
+
+const (
+	notifyDefaultMaxRetries = 5
+	notifyTimeout           = 10 * time.Second
+)
+
+// VersionEvent is the payload of the notification of the new version.
+type VersionEvent struct {
+	Module  string    `json:"module"`
+	Version string    `json:"version"`
+	Commit  string    `json:"commit"`
+	Time    time.Time `json:"time"`
+}
+
+// NewVersionEvents returns the events of the entries which are added to the index.
+// The version which is tagged before the module is observed first is omitted,
+// so that the existing tags are not notified when the repository is observed first or the index is created again.
+// firstSeen returns the time when the module is observed first (e.g. ModuleIndex.FirstSeen).
+func NewVersionEvents(root *ModuleRoot, added []IndexEntry, firstSeen func(mod string) time.Time) []VersionEvent {
+	var events []VersionEvent
+	for _, e := range added {
+		for _, m := range root.Modules {
+			if m.Path != e.Path {
+				continue
+			}
+			for _, v := range m.Versions {
+				if v.Semver != e.Version || v.Time.Before(firstSeen(m.Path)) {
+					continue
+				}
+				events = append(events, VersionEvent{Module: m.Path, Version: v.Semver, Commit: v.Commit, Time: v.Time})
+			}
+		}
+	}
+
+	return events
+}
+
+// NotificationTarget is the endpoint which receives the notification of the module matched by Match.
+// If Secret is not empty, the request has X-Signature-256 header which is "sha256=" + hex encoded HMAC-SHA256 of the body.
+type NotificationTarget struct {
+	Match  *regexp.Regexp
+	URL    string
+	Secret string
+}
+
+// Notifier posts VersionEvent to the targets.
+// The failed notification is retried with exponential backoff. The notification which is failed finally is appended to the dead letter file.
+type Notifier struct {
+	targets        []*NotificationTarget
+	maxRetries     int
+	deadLetterFile string
+	client         *http.Client
+	logger         logr.Logger
+
+	wg sync.WaitGroup
+	mu sync.Mutex
+	// backoff is the interval before the first retry. It is replaced in the test.
+	backoff time.Duration
+}
+
+// NewNotifier returns Notifier. If maxRetries is zero, the default value is used.
+// If deadLetterFile is empty, the failed notification is only logged.
+func NewNotifier(targets []*NotificationTarget, maxRetries int, deadLetterFile string, logger logr.Logger) *Notifier {
+	if maxRetries == 0 {
+		maxRetries = notifyDefaultMaxRetries
+	}
+
+	return &Notifier{
+		targets:        targets,
+		maxRetries:     maxRetries,
+		deadLetterFile: deadLetterFile,
+		client:         &http.Client{Transport: newTracingTransport(http.DefaultTransport), Timeout: notifyTimeout},
+		logger:         logger,
+		backoff:        time.Second,
+	}
+}
+
+// Notify sends the event to the targets which match the module in the background.
+func (n *Notifier) Notify(ev VersionEvent) {
+	for _, t := range n.targets {
+		if !t.Match.MatchString(ev.Module) {
+			continue
+		}
+
+		n.wg.Add(1)
+		go func(t *NotificationTarget) {
+			defer n.wg.Done()
+			n.deliver(t, ev)
+		}(t)
+	}
+}
+
+// Wait waits for the notifications which are being sent.
+func (n *Notifier) Wait() {
+	n.wg.Wait()
+}
+
+func (n *Notifier) deliver(t *NotificationTarget, ev VersionEvent) {
+	body, err := json.Marshal(ev)
+	if err != nil {
+		n.logger.Info("Failed to encode the event", xerrors.ZapField(err))
+		return
+	}
+
+	backoff := n.backoff
+	for i := 0; ; i++ {
+		retryable, err := n.post(t, body)
+		if err == nil {
+			n.logger.V(1).Info("Notified the new version", "url", t.URL, "module", ev.Module, "version", ev.Version)
+			return
+		}
+		if !retryable || i >= n.maxRetries {
+			n.logger.Info("Failed to notify the new version", "url", t.URL, "module", ev.Module, "version", ev.Version, "attempts", i+1, xerrors.ZapField(err))
+			n.writeDeadLetter(t, ev, err)
+			return
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// post sends the body to the target. It returns true if the failed request can be retried.
+func (n *Notifier) post(t *NotificationTarget, body []byte) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, xerrors.WithStack(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "gomodule-proxy")
+	if t.Secret != "" {
+		mac := hmac.New(sha256.New, []byte(t.Secret))
+		mac.Write(body)
+		req.Header.Set("X-Signature-256", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	res, err := n.client.Do(req)
+	if err != nil {
+		return true, xerrors.WithStack(err)
+	}
+	defer res.Body.Close()
+	_, _ = io.Copy(io.Discard, res.Body)
+	switch {
+	case res.StatusCode >= 200 && res.StatusCode < 300:
+		return false, nil
+	case res.StatusCode == http.StatusTooManyRequests || res.StatusCode >= 500:
+		return true, xerrors.Newf("unexpected status: %s", res.Status)
+	default:
+		return false, xerrors.Newf("unexpected status: %s", res.Status)
+	}
+}
+
+type deadLetter struct {
+	URL      string       `json:"url"`
+	Event    VersionEvent `json:"event"`
+	Error    string       `json:"error"`
+	FailedAt time.Time    `json:"failed_at"`
+}
+
+func (n *Notifier) writeDeadLetter(t *NotificationTarget, ev VersionEvent, cause error) {
+	if n.deadLetterFile == "" {
+		return
+	}
+	buf, err := json.Marshal(deadLetter{URL: t.URL, Event: ev, Error: cause.Error(), FailedAt: time.Now().UTC()})
+	if err != nil {
+		n.logger.Info("Failed to encode the dead letter", xerrors.ZapField(err))
+		return
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	f, err := os.OpenFile(n.deadLetterFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		n.logger.Info("Failed to open the dead letter file", xerrors.ZapField(err))
+		return
+	}
+	defer f.Close()
+	if _, err := f.Write(append(buf, '\n')); err != nil {
+		n.logger.Info("Failed to write the dead letter", xerrors.ZapField(err))
+	}
+}
@@ -0,0 +1,97 @@
+package gomodule
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewVersionEvents(t *testing.T) {
+	now := time.Now()
+	root := &ModuleRoot{Modules: []*Module{
+		{Path: "example.com/foo", Versions: []*ModuleVersion{
+			{Semver: "v1.0.0", Time: now.Add(-time.Hour), Commit: "aaa"},
+			{Semver: "v1.1.0", Time: now, Commit: "bbb"},
+		}},
+	}}
+	added := []IndexEntry{{Path: "example.com/foo", Version: "v1.0.0"}, {Path: "example.com/foo", Version: "v1.1.0"}}
+
+	// The version which is tagged before the module is observed first is not notified
+	events := NewVersionEvents(root, added, func(string) time.Time { return now.Add(-time.Minute) })
+	require.Len(t, events, 1)
+	assert.Equal(t, VersionEvent{Module: "example.com/foo", Version: "v1.1.0", Commit: "bbb", Time: now}, events[0])
+	assert.Empty(t, NewVersionEvents(root, added, func(string) time.Time { return now.Add(time.Minute) }))
+	assert.Len(t, NewVersionEvents(root, added, func(string) time.Time { return time.Time{} }), 2)
+}
+
+func TestNotifier(t *testing.T) {
+	var mu sync.Mutex
+	var received []VersionEvent
+	attempts := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		attempts++
+		if attempts == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := io.ReadAll(req.Body)
+		mac := hmac.New(sha256.New, []byte("secret"))
+		mac.Write(body)
+		if req.Header.Get("X-Signature-256") != "sha256="+hex.EncodeToString(mac.Sum(nil)) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var ev VersionEvent
+		if err := json.Unmarshal(body, &ev); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		received = append(received, ev)
+	}))
+	defer ts.Close()
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer failing.Close()
+
+	deadLetterFile := filepath.Join(t.TempDir(), "dead-letter.jsonl")
+	n := NewNotifier([]*NotificationTarget{
+		{Match: regexp.MustCompile(`^example.com/foo`), URL: ts.URL, Secret: "secret"},
+		{Match: regexp.MustCompile(`^example.com/bar`), URL: failing.URL},
+	}, 2, deadLetterFile, logr.Discard())
+	n.backoff = time.Millisecond
+
+	n.Notify(VersionEvent{Module: "example.com/foo", Version: "v1.0.0", Commit: "aaa"})
+	n.Notify(VersionEvent{Module: "example.com/bar", Version: "v0.1.0"})
+	n.Notify(VersionEvent{Module: "example.com/baz", Version: "v0.1.0"})
+	n.Wait()
+
+	// The first attempt is failed and retried
+	assert.Equal(t, 2, attempts)
+	require.Len(t, received, 1)
+	assert.Equal(t, "v1.0.0", received[0].Version)
+
+	buf, err := os.ReadFile(deadLetterFile)
+	require.NoError(t, err)
+	var dl deadLetter
+	require.NoError(t, json.Unmarshal(buf, &dl))
+	assert.Equal(t, failing.URL, dl.URL)
+	assert.Equal(t, "example.com/bar", dl.Event.Module)
+}
@@ -0,0 +1,377 @@
+package gomodule
+
+import (
+	"archive/zip"
+	"bytes"
+	"go/ast"
+	"go/doc"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"html/template"
+	"io"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/go-logr/logr"
+	"github.com/gorilla/mux"
+	"go.f110.dev/xerrors"
+)
+
+// ModuleDoc is the documentation of the module at the version.
+type ModuleDoc struct {
+	Path     string
+	Version  string
+	Readme   string
+	Packages []*PackageDoc
+}
+
+// Package returns the package in the directory. Package returns nil if the package is not found.
+func (m *ModuleDoc) Package(dir string) *PackageDoc {
+	for _, v := range m.Packages {
+		if v.Dir == dir {
+			return v
+		}
+	}
+
+	return nil
+}
+
+// PackageDoc is the documentation of the package.
+type PackageDoc struct {
+	ImportPath string
+	// Dir is the directory of the package relative to the module root. The root package is ".".
+	Dir string
+	Doc *doc.Package
+
+	fset *token.FileSet
+}
+
+func (p *PackageDoc) Synopsis() string {
+	return p.Doc.Synopsis(p.Doc.Doc)
+}
+
+// ReadModuleDoc reads the module zip and builds the documentation of the packages.
+// The directories which are ignored by the go command (testdata, vendor, and the names starting with "." or "_") are skipped.
+func ReadModuleDoc(r io.ReaderAt, size int64, mod, version string) (*ModuleDoc, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, xerrors.WithStack(err)
+	}
+
+	prefix := mod + "@" + version + "/"
+	modDoc := &ModuleDoc{Path: mod, Version: version}
+	files := make(map[string][]*zip.File)
+	for _, f := range zr.File {
+		name, ok := strings.CutPrefix(f.Name, prefix)
+		if !ok {
+			continue
+		}
+		dir, base := path.Split(name)
+		dir = strings.TrimSuffix(dir, "/")
+		if dir == "" && isReadme(base) && (modDoc.Readme == "" || strings.EqualFold(base, "README.md")) {
+			buf, err := readZipFile(f)
+			if err != nil {
+				return nil, err
+			}
+			modDoc.Readme = string(buf)
+			continue
+		}
+		if !strings.HasSuffix(base, ".go") || ignoredDir(dir) {
+			continue
+		}
+		files[dir] = append(files[dir], f)
+	}
+
+	for dir, v := range files {
+		p, err := newPackageDoc(mod, dir, v)
+		if err != nil {
+			return nil, err
+		}
+		if p != nil {
+			modDoc.Packages = append(modDoc.Packages, p)
+		}
+	}
+	sort.Slice(modDoc.Packages, func(i, j int) bool { return modDoc.Packages[i].ImportPath < modDoc.Packages[j].ImportPath })
+
+	return modDoc, nil
+}
+
+func newPackageDoc(mod, dir string, files []*zip.File) (*PackageDoc, error) {
+	importPath := mod
+	if dir != "" {
+		importPath = mod + "/" + dir
+	} else {
+		dir = "."
+	}
+
+	fset := token.NewFileSet()
+	var astFiles []*ast.File
+	names := make(map[string]int)
+	for _, f := range files {
+		buf, err := readZipFile(f)
+		if err != nil {
+			return nil, err
+		}
+		file, err := parser.ParseFile(fset, path.Base(f.Name), buf, parser.ParseComments)
+		if err != nil {
+			// The file which can not be parsed is not documented
+			continue
+		}
+		if !strings.HasSuffix(f.Name, "_test.go") {
+			names[file.Name.Name]++
+		}
+		astFiles = append(astFiles, file)
+	}
+	// The files which are excluded by the build constraints may have the other package name (e.g. package main of the generator)
+	var name string
+	for k, v := range names {
+		if v > names[name] || v == names[name] && k < name {
+			name = k
+		}
+	}
+	if name == "" {
+		// Only the test files are in the directory
+		return nil, nil
+	}
+	var pkgFiles []*ast.File
+	for _, v := range astFiles {
+		if n := v.Name.Name; n == name || n == name+"_test" {
+			pkgFiles = append(pkgFiles, v)
+		}
+	}
+
+	pkg, err := doc.NewFromFiles(fset, pkgFiles, importPath)
+	if err != nil {
+		return nil, xerrors.WithStack(err)
+	}
+	return &PackageDoc{ImportPath: importPath, Dir: dir, Doc: pkg, fset: fset}, nil
+}
+
+func readZipFile(f *zip.File) ([]byte, error) {
+	r, err := f.Open()
+	if err != nil {
+		return nil, xerrors.WithStack(err)
+	}
+	defer r.Close()
+	buf, err := io.ReadAll(r)
+	if err != nil {
+		return nil, xerrors.WithStack(err)
+	}
+
+	return buf, nil
+}
+
+func isReadme(name string) bool {
+	n := strings.ToLower(name)
+	return n == "readme" || n == "readme.md" || n == "readme.txt"
+}
+
+func ignoredDir(dir string) bool {
+	if dir == "" {
+		return false
+	}
+	for _, v := range strings.Split(dir, "/") {
+		if v == "testdata" || v == "vendor" || strings.HasPrefix(v, ".") || strings.HasPrefix(v, "_") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// DocHandler serves the documentation of the private modules.
+//
+//	GET /_doc/{module}@{version}              lists the packages and shows README of the module
+//	GET /_doc/{module}@{version}/{package}    shows the documentation of the package
+//
+// The version can be "latest".
+type DocHandler struct {
+	proxy  *ModuleProxy
+	auth   *Authenticator
+	logger logr.Logger
+}
+
+// NewDocHandler returns DocHandler. If auth is nil, the clients are not authenticated.
+func NewDocHandler(proxy *ModuleProxy, auth *Authenticator, logger logr.Logger) *DocHandler {
+	return &DocHandler{proxy: proxy, auth: auth, logger: logger}
+}
+
+func (h *DocHandler) Handler() http.Handler {
+	r := mux.NewRouter()
+	r.Methods(http.MethodGet).Path("/_doc/{path:.+}").HandlerFunc(h.doc)
+	r.Use(middlewareBrowserAuth(h.auth))
+
+	return r
+}
+
+func (h *DocHandler) doc(w http.ResponseWriter, req *http.Request) {
+	mod, rest, ok := strings.Cut(mux.Vars(req)["path"], "@")
+	if !ok {
+		http.Error(w, "the version is required", http.StatusBadRequest)
+		return
+	}
+	version, pkgDir, _ := strings.Cut(rest, "/")
+	if !h.proxy.IsProxy(mod) || !h.proxy.IsAllowed(mod, IdentityFromContext(req.Context())) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	if version == "latest" {
+		info, err := h.proxy.GetLatestVersion(req.Context(), mod)
+		if err != nil {
+			h.logger.Info("Failed to get the latest version", "module", mod, xerrors.ZapField(err))
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		version = info.Version
+	}
+	var buf bytes.Buffer
+	if err := h.proxy.GetZip(req.Context(), &buf, mod, version); err != nil {
+		h.logger.Info("Failed to get the zip", "module", mod, "version", version, xerrors.ZapField(err))
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	modDoc, err := ReadModuleDoc(bytes.NewReader(buf.Bytes()), int64(buf.Len()), mod, version)
+	if err != nil {
+		h.logger.Info("Failed to read the documentation", "module", mod, "version", version, xerrors.ZapField(err))
+		http.Error(w, "failed to read the module", http.StatusInternalServerError)
+		return
+	}
+
+	if pkgDir == "" {
+		renderPage(w, h.logger, docModuleTemplate, modDoc)
+		return
+	}
+	pkg := modDoc.Package(pkgDir)
+	if pkg == nil {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	renderPage(w, h.logger, docPackageTemplate, struct {
+		Module  *ModuleDoc
+		Package *PackageDoc
+	}{Module: modDoc, Package: pkg})
+}
+
+// docExample is the example of the package.
+type docExample struct {
+	Name   string
+	Code   string
+	Output string
+}
+
+// HTML returns the doc comment formatted in HTML.
+func (p *PackageDoc) HTML(text string) template.HTML {
+	return template.HTML(p.Doc.HTML(text))
+}
+
+// Source returns the source code of the node. It is used for printing the declarations.
+func (p *PackageDoc) Source(node interface{}) string {
+	var buf bytes.Buffer
+	if err := printer.Fprint(&buf, p.fset, node); err != nil {
+		return ""
+	}
+
+	return buf.String()
+}
+
+// Examples returns all examples of the package including the examples of the functions, the types and the methods.
+func (p *PackageDoc) Examples() []docExample {
+	examples := append([]*doc.Example{}, p.Doc.Examples...)
+	for _, f := range p.Doc.Funcs {
+		examples = append(examples, f.Examples...)
+	}
+	for _, t := range p.Doc.Types {
+		examples = append(examples, t.Examples...)
+		for _, f := range t.Funcs {
+			examples = append(examples, f.Examples...)
+		}
+		for _, f := range t.Methods {
+			examples = append(examples, f.Examples...)
+		}
+	}
+
+	var result []docExample
+	for _, ex := range examples {
+		var node interface{} = ex.Code
+		if ex.Play != nil {
+			node = ex.Play
+		}
+		result = append(result, docExample{Name: "Example" + ex.Name, Code: p.Source(node), Output: ex.Output})
+	}
+
+	return result
+}
+
+var (
+	docModuleTemplate = template.Must(template.Must(template.New("layout").Parse(uiLayout)).Parse(`
+{{ define "title" }}{{ .Path }}@{{ .Version }}{{ end }}
+{{ define "nav" }}{{ end }}
+{{ define "content" }}
+<h1>{{ .Path }}@{{ .Version }}</h1>
+<h2>Packages</h2>
+{{ if .Packages }}
+<table>
+<tr><th>Package</th><th>Synopsis</th></tr>
+{{ range .Packages }}<tr><td><a href="/_doc/{{ $.Path }}@{{ $.Version }}/{{ .Dir }}">{{ .ImportPath }}</a></td><td>{{ .Synopsis }}</td></tr>
+{{ end }}
+</table>
+{{ else }}
+<p>No package is found.</p>
+{{ end }}
+{{ if .Readme }}
+<h2>README</h2>
+<pre>{{ .Readme }}</pre>
+{{ end }}
+{{ end }}
+`))
+
+	docPackageTemplate = template.Must(template.Must(template.New("layout").Parse(uiLayout)).Parse(`
+{{ define "title" }}{{ .Package.ImportPath }}{{ end }}
+{{ define "nav" }}<nav><a href="/_doc/{{ .Module.Path }}@{{ .Module.Version }}">{{ .Module.Path }}@{{ .Module.Version }}</a></nav>{{ end }}
+{{ define "content" }}
+{{ $pkg := .Package }}{{ with .Package }}
+<h1>package {{ .Doc.Name }}</h1>
+<pre>import "{{ .ImportPath }}"</pre>
+{{ $pkg.HTML .Doc.Doc }}
+{{ if .Doc.Consts }}<h2>Constants</h2>
+{{ range .Doc.Consts }}<pre>{{ $pkg.Source .Decl }}</pre>
+{{ $pkg.HTML .Doc }}
+{{ end }}{{ end }}
+{{ if .Doc.Vars }}<h2>Variables</h2>
+{{ range .Doc.Vars }}<pre>{{ $pkg.Source .Decl }}</pre>
+{{ $pkg.HTML .Doc }}
+{{ end }}{{ end }}
+{{ if .Doc.Funcs }}<h2>Functions</h2>
+{{ range .Doc.Funcs }}<h3 id="{{ .Name }}">func {{ .Name }}</h3>
+<pre>{{ $pkg.Source .Decl }}</pre>
+{{ $pkg.HTML .Doc }}
+{{ end }}{{ end }}
+{{ if .Doc.Types }}<h2>Types</h2>
+{{ range .Doc.Types }}<h3 id="{{ .Name }}">type {{ .Name }}</h3>
+<pre>{{ $pkg.Source .Decl }}</pre>
+{{ $pkg.HTML .Doc }}
+{{ range .Consts }}<pre>{{ $pkg.Source .Decl }}</pre>
+{{ $pkg.HTML .Doc }}
+{{ end }}{{ range .Vars }}<pre>{{ $pkg.Source .Decl }}</pre>
+{{ $pkg.HTML .Doc }}
+{{ end }}{{ range .Funcs }}<h4 id="{{ .Name }}">func {{ .Name }}</h4>
+<pre>{{ $pkg.Source .Decl }}</pre>
+{{ $pkg.HTML .Doc }}
+{{ end }}{{ range .Methods }}<h4 id="{{ .Recv }}.{{ .Name }}">func ({{ .Recv }}) {{ .Name }}</h4>
+<pre>{{ $pkg.Source .Decl }}</pre>
+{{ $pkg.HTML .Doc }}
+{{ end }}{{ end }}{{ end }}
+{{ with .Examples }}<h2>Examples</h2>
+{{ range . }}<h3>{{ .Name }}</h3>
+<pre>{{ .Code }}</pre>
+{{ if .Output }}<p>Output:</p>
+<pre>{{ .Output }}</pre>{{ end }}
+{{ end }}{{ end }}
+{{ end }}
+{{ end }}
+`))
+)
@@ -0,0 +1,69 @@
+package gomodule
+
+import (
+	"archive/zip"
+	"bytes"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestModuleZip(t *testing.T, mod, version string, files map[string]string) []byte {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range files {
+		w, err := zw.Create(mod + "@" + version + "/" + name)
+		require.NoError(t, err)
+		_, err = w.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, zw.Close())
+
+	return buf.Bytes()
+}
+
+func TestReadModuleDoc(t *testing.T) {
+	buf := newTestModuleZip(t, "example.com/foo", "v1.0.0", map[string]string{
+		"README.md":       "# foo\n",
+		"go.mod":          "module example.com/foo\n",
+		"foo.go":          "// Package foo is an example.\npackage foo\n\n// Hello returns the greeting.\nfunc Hello() string { return \"hello\" }\n\nfunc internal() {}\n",
+		"foo_test.go":     "package foo_test\n\nimport \"fmt\"\n\nfunc ExampleHello() {\n\tfmt.Println(\"hello\")\n\t// Output: hello\n}\n",
+		"gen.go":          "//go:build ignore\n\npackage main\n\nfunc main() {}\n",
+		"bar/bar.go":      "// Package bar is a sub package.\npackage bar\n\n// Bar is a type.\ntype Bar struct {\n\tName string\n\tsecret string\n}\n\n// String returns the name.\nfunc (b *Bar) String() string { return b.Name }\n",
+		"testdata/baz.go": "package baz\n",
+	})
+
+	modDoc, err := ReadModuleDoc(bytes.NewReader(buf), int64(len(buf)), "example.com/foo", "v1.0.0")
+	require.NoError(t, err)
+	assert.Equal(t, "# foo\n", modDoc.Readme)
+	require.Len(t, modDoc.Packages, 2)
+	assert.Equal(t, "example.com/foo", modDoc.Packages[0].ImportPath)
+	assert.Equal(t, ".", modDoc.Packages[0].Dir)
+	assert.Equal(t, "Package foo is an example.", modDoc.Packages[0].Synopsis())
+	assert.Equal(t, "example.com/foo/bar", modDoc.Packages[1].ImportPath)
+
+	pkg := modDoc.Package(".")
+	require.NotNil(t, pkg)
+	require.Len(t, pkg.Doc.Funcs, 1)
+	assert.Equal(t, "Hello", pkg.Doc.Funcs[0].Name)
+	examples := pkg.Examples()
+	require.Len(t, examples, 1)
+	assert.Equal(t, "ExampleHello", examples[0].Name)
+	assert.Equal(t, "hello\n", examples[0].Output)
+	assert.Nil(t, modDoc.Package("testdata"))
+
+	rec := httptest.NewRecorder()
+	renderPage(rec, logr.Discard(), docPackageTemplate, struct {
+		Module  *ModuleDoc
+		Package *PackageDoc
+	}{Module: modDoc, Package: modDoc.Package("bar")})
+	assert.Contains(t, rec.Body.String(), "func (b *Bar) String() string")
+	assert.NotContains(t, rec.Body.String(), "secret")
+
+	rec = httptest.NewRecorder()
+	renderPage(rec, logr.Discard(), docModuleTemplate, modDoc)
+	assert.Contains(t, rec.Body.String(), `href="/_doc/example.com/foo@v1.0.0/bar"`)
+}
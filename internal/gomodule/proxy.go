@@ -2,44 +2,354 @@ package gomodule
 
 import (
 	"context"
+	"encoding/json"
 	"io"
 	"net/http"
 	"regexp"
+	"slices"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/google/go-github/v40/github"
 	"go.f110.dev/xerrors"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/tools/go/vcs"
 )
 
 const (
 	moduleProxyUserAgent = "gomodule-proxy/v0.1 github.com/f110/gomodule-proxy"
 )
 
+// ModuleRule is the rule of the module which is served by ModuleProxy.
+type ModuleRule struct {
+	Match *regexp.Regexp
+	// AllowedUsers and AllowedGroups restrict the clients which can access to the module.
+	// If both are empty, any client can access to the module.
+	AllowedUsers  []string
+	AllowedGroups []string
+	// Repository is the URL of the git repository of the module. It is used for the vanity import path.
+	// If it is not empty, Prefix is required and Match has to match only Prefix and the paths under it.
+	Repository string
+	// Prefix is the literal import path prefix of the vanity import path.
+	Prefix string
+}
+
+// IsAllowed returns true if the client can access to the module.
+func (r *ModuleRule) IsAllowed(id *Identity) bool {
+	if len(r.AllowedUsers) == 0 && len(r.AllowedGroups) == 0 {
+		return true
+	}
+	if id == nil {
+		return false
+	}
+
+	for _, v := range r.AllowedUsers {
+		if v == id.Name {
+			return true
+		}
+	}
+	for _, v := range r.AllowedGroups {
+		for _, g := range id.Groups {
+			if v == g {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// equal returns true if both rules have the same pattern and the same access control.
+func (r *ModuleRule) equal(other *ModuleRule) bool {
+	return r.Match.String() == other.Match.String() &&
+		slices.Equal(r.AllowedUsers, other.AllowedUsers) &&
+		slices.Equal(r.AllowedGroups, other.AllowedGroups) &&
+		r.Repository == other.Repository
+}
+
+// VanityPrefix returns the import path prefix of the vanity import path.
+// It returns an empty string if the rule doesn't have the repository.
+func (r *ModuleRule) VanityPrefix() string {
+	if r.Repository == "" {
+		return ""
+	}
+
+	return r.Prefix
+}
+
+// ModuleRuleDiff is the difference of the rules which is made by ModuleProxy.SetModules.
+// Each item is the pattern of the rule.
+type ModuleRuleDiff struct {
+	Added   []string
+	Removed []string
+	// Changed is the rules which have the same pattern but different access control.
+	Changed []string
+}
+
+func (d ModuleRuleDiff) IsEmpty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
 type ModuleProxy struct {
-	modules []*regexp.Regexp
+	mu      sync.RWMutex
+	modules []*ModuleRule
+	forks   []*ForkRule
 
 	fetcher      *ModuleFetcher
+	cache        *ArtifactCache
 	httpClient   *http.Client
 	githubClient *github.Client
 }
 
-func NewModuleProxy(modules []*regexp.Regexp, moduleDir string, githubClient *github.Client) *ModuleProxy {
-	return &ModuleProxy{
+// NewModuleProxy returns ModuleProxy.
+// The versions of the repository are cached for refreshInterval. See NewModuleFetcher.
+// cache is optional. If it is not nil, the artifacts of the module are stored and served from it.
+func NewModuleProxy(modules []*ModuleRule, moduleDir string, refreshInterval time.Duration, cache *ArtifactCache, githubClient *github.Client, metrics *Metrics) *ModuleProxy {
+	m := &ModuleProxy{
 		modules:      modules,
-		fetcher:      NewModuleFetcher(moduleDir),
+		fetcher:      NewModuleFetcher(moduleDir, refreshInterval, metrics),
+		cache:        cache,
 		githubClient: githubClient,
 		httpClient:   &http.Client{},
 	}
+	m.fetcher.resolve = m.resolveRepoRoot
+
+	return m
+}
+
+// resolveRepoRoot returns the repository of the import path.
+// The forked module and the vanity import path are resolved by the rules, and the others are resolved by the go-get protocol.
+func (m *ModuleProxy) resolveRepoRoot(importPath string) (*vcs.RepoRoot, error) {
+	if repoRoot := m.resolveForkRepoRoot(importPath); repoRoot != nil {
+		return repoRoot, nil
+	}
+	if rule := m.VanityRule(importPath); rule != nil {
+		return &vcs.RepoRoot{VCS: vcs.ByCmd("git"), Repo: rule.Repository, Root: rule.VanityPrefix()}, nil
+	}
+
+	return resolveRepoRoot(importPath)
+}
+
+// VanityRule returns the rule which has the repository of the vanity import path. It returns nil if the import path is not a vanity import path.
+func (m *ModuleProxy) VanityRule(importPath string) *ModuleRule {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, v := range m.modules {
+		prefix := v.VanityPrefix()
+		if prefix == "" {
+			continue
+		}
+		if importPath == prefix || strings.HasPrefix(importPath, prefix+"/") {
+			return v
+		}
+	}
+
+	return nil
+}
+
+// RepositoryModules returns the import paths which are refreshed for the repository (e.g. github.com/org/repo).
+// The repository is looked up in the vanity import paths, the repositories which have been fetched and the module rules,
+// so the repository of the module which is served through a vanity import path is found by the URL of the repository.
+func (m *ModuleProxy) RepositoryModules(repo string) []string {
+	seen := make(map[string]struct{})
+	var modules []string
+	add := func(mod string) {
+		if _, ok := seen[mod]; ok {
+			return
+		}
+		seen[mod] = struct{}{}
+		modules = append(modules, mod)
+	}
+
+	m.mu.RLock()
+	for _, v := range m.modules {
+		if v.Repository != "" && repoPathFromURL(v.Repository) == repo {
+			add(v.VanityPrefix())
+		}
+	}
+	m.mu.RUnlock()
+	for _, v := range m.fetcher.Repositories() {
+		if v.Root == repo || repoPathFromURL(v.URL) == repo {
+			add(v.Root)
+		}
+	}
+	if len(modules) == 0 && m.IsProxy(repo) {
+		add(repo)
+	}
+
+	return modules
+}
+
+// SetModules replaces the rules atomically.
+// The request which is being served is not affected by the replacement.
+func (m *ModuleProxy) SetModules(modules []*ModuleRule) ModuleRuleDiff {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.setModules(modules)
+}
+
+// SetConfig replaces the module rules and the fork rules at once.
+// The request never sees the module rules and the fork rules which come from the different configurations.
+func (m *ModuleProxy) SetConfig(modules []*ModuleRule, forks []*ForkRule) ModuleRuleDiff {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.forks = forks
+	return m.setModules(modules)
+}
+
+func (m *ModuleProxy) setModules(modules []*ModuleRule) ModuleRuleDiff {
+	var diff ModuleRuleDiff
+	current := make(map[string]*ModuleRule)
+	for _, v := range m.modules {
+		current[v.Match.String()] = v
+	}
+	next := make(map[string]struct{})
+	for _, v := range modules {
+		next[v.Match.String()] = struct{}{}
+		old, ok := current[v.Match.String()]
+		switch {
+		case !ok:
+			diff.Added = append(diff.Added, v.Match.String())
+		case !old.equal(v):
+			diff.Changed = append(diff.Changed, v.Match.String())
+		}
+	}
+	for _, v := range m.modules {
+		if _, ok := next[v.Match.String()]; !ok {
+			diff.Removed = append(diff.Removed, v.Match.String())
+		}
+	}
+	m.modules = modules
+
+	return diff
 }
 
 func (m *ModuleProxy) IsProxy(module string) bool {
+	return m.findRule(module) != nil
+}
+
+// IsAllowed returns true if the client can access to the module.
+// The module which is not served by ModuleProxy is always allowed.
+func (m *ModuleProxy) IsAllowed(module string, id *Identity) bool {
+	rule := m.findRule(module)
+	if rule == nil {
+		return true
+	}
+
+	return rule.IsAllowed(id)
+}
+
+func (m *ModuleProxy) findRule(module string) *ModuleRule {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
 	for _, v := range m.modules {
-		if v.MatchString(module) {
-			return true
+		if v.Match.MatchString(module) {
+			return v
 		}
 	}
 
-	return false
+	return nil
+}
+
+// ConfiguredModules returns the module paths which are configured literally.
+// The modules configured by a pattern are not included because they can not be enumerated.
+// A dot is treated as a literal character because it is usually written unescaped in the module path.
+func (m *ModuleProxy) ConfiguredModules() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var modules []string
+	for _, v := range m.modules {
+		if prefix := v.VanityPrefix(); prefix != "" {
+			modules = append(modules, prefix)
+			continue
+		}
+		if strings.ContainsAny(v.Match.String(), `\+*?()|[]{}^$`) {
+			continue
+		}
+		modules = append(modules, v.Match.String())
+	}
+
+	return modules
+}
+
+// Refresh fetches the repository of the module from the remote and discards the cached versions.
+func (m *ModuleProxy) Refresh(ctx context.Context, module string) error {
+	ctx, span := tracer.Start(ctx, "ModuleProxy.Refresh", trace.WithAttributes(attribute.String("module", module)))
+	defer span.End()
+
+	_, err := m.fetcher.Refresh(ctx, module)
+	return err
+}
+
+// Rediscover finds the modules and the versions of the repository again from the local clone.
+func (m *ModuleProxy) Rediscover(ctx context.Context, repoRoot string) error {
+	_, err := m.fetcher.Rediscover(ctx, repoRoot)
+	return err
+}
+
+// Repositories returns the state of the repositories which have been fetched.
+func (m *ModuleProxy) Repositories() []RepositoryStatus {
+	return m.fetcher.Repositories()
+}
+
+// PurgeCache removes the cached artifacts of the module. If version is empty, all versions are removed.
+func (m *ModuleProxy) PurgeCache(module, version string) error {
+	return m.cache.Purge(module, version)
+}
+
+// AddObserver registers fn which is called with the modules and the versions every time the repository is discovered.
+// It must be called before serving.
+func (m *ModuleProxy) AddObserver(fn func(*ModuleRoot)) {
+	m.fetcher.AddObserver(fn)
+}
+
+// ModuleRoot returns the repository which has the module. ModuleRoot.Modules has the nested modules in the repository too.
+func (m *ModuleProxy) ModuleRoot(ctx context.Context, module string) (*ModuleRoot, error) {
+	return m.fetcher.Fetch(ctx, module)
+}
+
+// ModuleRoots returns the repositories which have been fetched. The repositories are not fetched from the remote.
+func (m *ModuleProxy) ModuleRoots() []*ModuleRoot {
+	return m.fetcher.Roots()
+}
+
+// FetchConfiguredModules fetches the repositories of ConfiguredModules with at most concurrency goroutines.
+// The repository which has been fetched within the refresh interval is not fetched again.
+// done is called with the result of each module. It may be called concurrently.
+func (m *ModuleProxy) FetchConfiguredModules(ctx context.Context, concurrency int, done func(mod string, err error)) {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for _, v := range m.ConfiguredModules() {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			wg.Wait()
+			return
+		}
+
+		wg.Add(1)
+		go func(mod string) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			_, err := m.fetcher.Fetch(ctx, mod)
+			done(mod, err)
+		}(v)
+	}
+	wg.Wait()
 }
 
 func (m *ModuleProxy) IsUpstream(module string) bool {
@@ -49,9 +359,14 @@ func (m *ModuleProxy) IsUpstream(module string) bool {
 type Info struct {
 	Version string
 	Time    time.Time
+	// Fork is the origin of the version which is served from the fork.
+	Fork *ForkInfo `json:",omitempty"`
 }
 
 func (m *ModuleProxy) Versions(ctx context.Context, module string) ([]string, error) {
+	ctx, span := tracer.Start(ctx, "ModuleProxy.Versions", trace.WithAttributes(attribute.String("module", module)))
+	defer span.End()
+
 	modRoot, err := m.fetcher.Fetch(ctx, module)
 	if err != nil {
 		return nil, err
@@ -70,6 +385,17 @@ func (m *ModuleProxy) Versions(ctx context.Context, module string) ([]string, er
 }
 
 func (m *ModuleProxy) GetInfo(ctx context.Context, module, version string) (Info, error) {
+	ctx, span := tracer.Start(ctx, "ModuleProxy.GetInfo", trace.WithAttributes(attribute.String("module", module), attribute.String("version", version)))
+	defer span.End()
+
+	if f, err := m.cache.Open(module, version, ArtifactInfo); err == nil {
+		defer f.Close()
+		var info Info
+		if err := json.NewDecoder(f).Decode(&info); err == nil {
+			return info, nil
+		}
+	}
+
 	modRoot, err := m.fetcher.Fetch(ctx, module)
 	if err != nil {
 		return Info{}, err
@@ -87,7 +413,14 @@ func (m *ModuleProxy) GetInfo(ctx context.Context, module, version string) (Info
 	}
 	for _, v := range mod.Versions {
 		if version == v.Semver {
-			return Info{Version: v.Semver, Time: v.Time}, nil
+			info := Info{Version: v.Semver, Time: v.Time}
+			err := m.cache.Put(module, version, ArtifactInfo, func(w io.Writer) error {
+				return json.NewEncoder(w).Encode(info)
+			})
+			if err != nil {
+				span.RecordError(err)
+			}
+			return info, nil
 		}
 	}
 
@@ -95,6 +428,9 @@ func (m *ModuleProxy) GetInfo(ctx context.Context, module, version string) (Info
 }
 
 func (m *ModuleProxy) GetLatestVersion(ctx context.Context, module string) (Info, error) {
+	ctx, span := tracer.Start(ctx, "ModuleProxy.GetLatestVersion", trace.WithAttributes(attribute.String("module", module)))
+	defer span.End()
+
 	modRoot, err := m.fetcher.Fetch(ctx, module)
 	if err != nil {
 		return Info{}, err
@@ -111,11 +447,25 @@ func (m *ModuleProxy) GetLatestVersion(ctx context.Context, module string) (Info
 		return Info{}, xerrors.Newf("%s is not found", module)
 	}
 
+	if len(mod.Versions) == 0 {
+		return Info{}, xerrors.Newf("%s has no version", module)
+	}
 	modVer := mod.Versions[len(mod.Versions)-1]
-	return Info{Version: modVer.Version, Time: modVer.Time}, nil
+	// Version is the tag name (e.g. pkg/api/v1.0.0) for the nested module
+	return Info{Version: modVer.Semver, Time: modVer.Time}, nil
 }
 
 func (m *ModuleProxy) GetGoMod(ctx context.Context, module, version string) (string, error) {
+	ctx, span := tracer.Start(ctx, "ModuleProxy.GetGoMod", trace.WithAttributes(attribute.String("module", module), attribute.String("version", version)))
+	defer span.End()
+
+	if f, err := m.cache.Open(module, version, ArtifactMod); err == nil {
+		defer f.Close()
+		if buf, err := io.ReadAll(f); err == nil {
+			return string(buf), nil
+		}
+	}
+
 	modRoot, err := m.fetcher.Fetch(ctx, module)
 	if err != nil {
 		return "", err
@@ -136,24 +486,49 @@ func (m *ModuleProxy) GetGoMod(ctx context.Context, module, version string) (str
 	if err != nil {
 		return "", xerrors.Newf(": %w", err)
 	}
+	err = m.cache.Put(module, version, ArtifactMod, func(w io.Writer) error {
+		_, err := w.Write(goMod)
+		return xerrors.WithStack(err)
+	})
+	if err != nil {
+		span.RecordError(err)
+	}
 
 	return string(goMod), nil
 }
 
 func (m *ModuleProxy) GetZip(ctx context.Context, w io.Writer, module, version string) error {
-	modRoot, err := m.fetcher.Fetch(ctx, module)
-	if err != nil {
-		return err
+	ctx, span := tracer.Start(ctx, "ModuleProxy.GetZip", trace.WithAttributes(attribute.String("module", module), attribute.String("version", version)))
+	defer span.End()
+
+	if m.cache == nil {
+		return m.archive(ctx, w, module, version)
 	}
 
-	err = modRoot.Archive(w, module, version)
+	if !m.cache.Has(module, version, ArtifactZip) {
+		err := m.cache.Put(module, version, ArtifactZip, func(w io.Writer) error {
+			return m.archive(ctx, w, module, version)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	f, err := m.cache.Open(module, version, ArtifactZip)
 	if err != nil {
 		return err
 	}
+	defer f.Close()
+	if _, err := io.Copy(w, f); err != nil {
+		return xerrors.WithStack(err)
+	}
 
 	return nil
 }
 
+func (m *ModuleProxy) archive(ctx context.Context, w io.Writer, module, version string) error {
+	return m.fetcher.Archive(ctx, w, module, version)
+}
+
 type httpTransport struct{}
 
 var _ http.RoundTripper = &httpTransport{}
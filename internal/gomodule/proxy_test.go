@@ -0,0 +1,108 @@
+package gomodule
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/tools/go/vcs"
+)
+
+// setTestModuleRoot makes the fetcher of proxy return root for the modules under root.RootPath without fetching the repository.
+func setTestModuleRoot(proxy *ModuleProxy, root *ModuleRoot) {
+	proxy.fetcher.refreshInterval = time.Hour
+	proxy.fetcher.resolve = func(importPath string) (*vcs.RepoRoot, error) {
+		return &vcs.RepoRoot{VCS: vcs.ByCmd("git"), Root: root.RootPath}, nil
+	}
+	repo := proxy.fetcher.repository(root.RootPath)
+	repo.root = root
+	repo.fetchedAt = time.Now()
+}
+
+func TestModuleProxy_IsAllowed(t *testing.T) {
+	proxy := NewModuleProxy([]*ModuleRule{
+		{Match: regexp.MustCompile(`^example.com/team-a/`), AllowedUsers: []string{"alice"}, AllowedGroups: []string{"team-a"}},
+		{Match: regexp.MustCompile(`^example.com/public/`)},
+	}, t.TempDir(), 0, nil, nil, nil)
+
+	alice := &Identity{Name: "alice"}
+	bob := &Identity{Name: "bob", Groups: []string{"team-a"}}
+	carol := &Identity{Name: "carol", Groups: []string{"team-b"}}
+
+	assert.True(t, proxy.IsAllowed("example.com/team-a/foo", alice))
+	assert.True(t, proxy.IsAllowed("example.com/team-a/foo", bob))
+	assert.False(t, proxy.IsAllowed("example.com/team-a/foo", carol))
+	assert.False(t, proxy.IsAllowed("example.com/team-a/foo", nil))
+	assert.True(t, proxy.IsAllowed("example.com/public/foo", carol))
+	assert.True(t, proxy.IsAllowed("example.com/public/foo", nil))
+	assert.True(t, proxy.IsAllowed("github.com/f110/gomodule-proxy", nil))
+}
+
+func TestModuleProxy_SetModules(t *testing.T) {
+	proxy := NewModuleProxy([]*ModuleRule{
+		{Match: regexp.MustCompile(`^example.com/team-a/`), AllowedUsers: []string{"alice"}},
+		{Match: regexp.MustCompile(`^example.com/team-b/`)},
+		{Match: regexp.MustCompile(`^example.com/public/`)},
+	}, t.TempDir(), 0, nil, nil, nil)
+
+	diff := proxy.SetModules([]*ModuleRule{
+		{Match: regexp.MustCompile(`^example.com/team-a/`), AllowedUsers: []string{"alice", "bob"}},
+		{Match: regexp.MustCompile(`^example.com/public/`)},
+		{Match: regexp.MustCompile(`^example.com/team-c/`)},
+	})
+	assert.Equal(t, []string{`^example.com/team-c/`}, diff.Added)
+	assert.Equal(t, []string{`^example.com/team-b/`}, diff.Removed)
+	assert.Equal(t, []string{`^example.com/team-a/`}, diff.Changed)
+
+	assert.True(t, proxy.IsProxy("example.com/team-c/foo"))
+	assert.False(t, proxy.IsProxy("example.com/team-b/foo"))
+	assert.True(t, proxy.IsAllowed("example.com/team-a/foo", &Identity{Name: "bob"}))
+
+	diff = proxy.SetModules([]*ModuleRule{
+		{Match: regexp.MustCompile(`^example.com/team-a/`), AllowedUsers: []string{"alice", "bob"}},
+		{Match: regexp.MustCompile(`^example.com/public/`)},
+		{Match: regexp.MustCompile(`^example.com/team-c/`)},
+	})
+	assert.True(t, diff.IsEmpty())
+}
+
+func TestModuleProxy_SetConfig(t *testing.T) {
+	proxy := NewModuleProxy([]*ModuleRule{{Match: regexp.MustCompile(`^example.com/team-a/`)}}, t.TempDir(), 0, nil, nil, nil)
+	proxy.SetForks([]*ForkRule{{Module: "github.com/upstream/foo", Repository: "https://github.com/me/foo"}})
+
+	diff := proxy.SetConfig(
+		[]*ModuleRule{{Match: regexp.MustCompile(`^example.com/team-b/`)}},
+		[]*ForkRule{{Module: "github.com/upstream/bar", Repository: "https://github.com/me/bar"}},
+	)
+	assert.Equal(t, []string{`^example.com/team-b/`}, diff.Added)
+	assert.Equal(t, []string{`^example.com/team-a/`}, diff.Removed)
+	assert.True(t, proxy.IsProxy("example.com/team-b/foo"))
+	assert.False(t, proxy.IsProxy("example.com/team-a/foo"))
+	assert.True(t, proxy.IsFork("github.com/upstream/bar"))
+	assert.False(t, proxy.IsFork("github.com/upstream/foo"))
+}
+
+func TestModuleProxy_GetLatestVersion(t *testing.T) {
+	proxy := NewModuleProxy([]*ModuleRule{{Match: regexp.MustCompile(`^example.com/foo`)}}, t.TempDir(), 0, nil, nil, nil)
+	setTestModuleRoot(proxy, &ModuleRoot{
+		RootPath: "example.com/foo",
+		Modules: []*Module{
+			{Path: "example.com/foo"},
+			{Path: "example.com/foo/pkg/api", Versions: []*ModuleVersion{
+				{Version: "pkg/api/v1.0.0", Semver: "v1.0.0"},
+				{Version: "pkg/api/v1.1.0", Semver: "v1.1.0"},
+			}},
+		},
+	})
+
+	info, err := proxy.GetLatestVersion(context.Background(), "example.com/foo/pkg/api")
+	require.NoError(t, err)
+	assert.Equal(t, "v1.1.0", info.Version)
+
+	// The module which doesn't have any tag
+	_, err = proxy.GetLatestVersion(context.Background(), "example.com/foo")
+	assert.Error(t, err)
+}
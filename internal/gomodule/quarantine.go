@@ -0,0 +1,236 @@
+package gomodule
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"regexp"
+	"sync"
+	"time"
+
+	"go.f110.dev/xerrors"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
+)
+
+const (
+	// quarantineConcurrency is the number of .info which are fetched from the upstream concurrently.
+	quarantineConcurrency = 8
+	// quarantineCacheSize is the maximum number of the versions whose published time is cached.
+	quarantineCacheSize = 100000
+	// quarantineNegativeCacheDuration is the duration of caching the failure of fetching .info.
+	quarantineNegativeCacheDuration = 5 * time.Minute
+)
+
+// ErrQuarantined is returned when the version was published in the quarantine period.
+var ErrQuarantined = xerrors.New("the version is quarantined")
+
+// Quarantine hides the versions of the upstream modules which were published less than Duration ago.
+// The published time is the time of .info of the upstream.
+// The version which can't be verified (e.g. .info is not available) is also hidden.
+type Quarantine struct {
+	upstream *Upstream
+	duration time.Duration
+	// blockRequested also blocks the version which is requested explicitly (.info, .mod and .zip).
+	// If false, only list and @latest are filtered.
+	blockRequested bool
+	exclude        []*regexp.Regexp
+
+	mu sync.Mutex
+	// times is the published time of the versions. The least recently used entry is evicted from lru when the cache is full.
+	times      map[module.Version]*list.Element
+	lru        *list.List
+	maxEntries int
+
+	// now is replaced in the test
+	now func() time.Time
+}
+
+// NewQuarantine returns Quarantine. The modules which are matched by exclude are not quarantined.
+func NewQuarantine(upstream *Upstream, duration time.Duration, blockRequested bool, exclude []*regexp.Regexp) *Quarantine {
+	return &Quarantine{
+		upstream:       upstream,
+		duration:       duration,
+		blockRequested: blockRequested,
+		exclude:        exclude,
+		times:          make(map[module.Version]*list.Element),
+		lru:            list.New(),
+		maxEntries:     quarantineCacheSize,
+		now:            time.Now,
+	}
+}
+
+// Applies returns true if the versions of the module are quarantined.
+func (q *Quarantine) Applies(mod string) bool {
+	for _, v := range q.exclude {
+		if v.MatchString(mod) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Versions returns the versions of the module which are out of the quarantine period.
+func (q *Quarantine) Versions(ctx context.Context, mod string) ([]string, error) {
+	versions, err := q.upstream.Versions(ctx, mod)
+	if err != nil {
+		return nil, err
+	}
+
+	released := make([]bool, len(versions))
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, quarantineConcurrency)
+	for i, v := range versions {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, version string) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			released[i] = q.check(ctx, mod, version) == nil
+		}(i, v)
+	}
+	wg.Wait()
+
+	var result []string
+	for i, v := range versions {
+		if released[i] {
+			result = append(result, v)
+		}
+	}
+	return result, nil
+}
+
+// Latest returns the latest version of the module which is out of the quarantine period.
+// If the latest version of the upstream is quarantined, the highest version in the list is used like the go command.
+func (q *Quarantine) Latest(ctx context.Context, mod string) (Info, error) {
+	info, err := q.upstream.GetLatestVersion(ctx, mod)
+	if err != nil {
+		return Info{}, err
+	}
+	q.record(mod, info)
+	if !q.isQuarantined(info.Time) {
+		return info, nil
+	}
+
+	versions, err := q.Versions(ctx, mod)
+	if err != nil {
+		return Info{}, err
+	}
+	var latest string
+	for _, v := range versions {
+		// The release version takes precedence over the pre-release version
+		switch {
+		case latest == "":
+		case semver.Prerelease(v) != "" && semver.Prerelease(latest) == "":
+			continue
+		case semver.Prerelease(v) == "" && semver.Prerelease(latest) != "":
+		case semver.Compare(v, latest) <= 0:
+			continue
+		}
+		latest = v
+	}
+	if latest == "" {
+		return Info{}, xerrors.Newf("%s: all versions are quarantined: %w", mod, ErrQuarantined)
+	}
+
+	return q.info(ctx, mod, latest)
+}
+
+// Check returns ErrQuarantined if the version which is requested explicitly is blocked.
+func (q *Quarantine) Check(ctx context.Context, mod, version string) error {
+	if !q.blockRequested {
+		return nil
+	}
+
+	return q.check(ctx, mod, version)
+}
+
+func (q *Quarantine) check(ctx context.Context, mod, version string) error {
+	info, err := q.info(ctx, mod, version)
+	if errors.Is(err, ErrNotFound) {
+		return err
+	}
+	if err != nil {
+		return xerrors.Newf("%s@%s can not be verified: %v: %w", mod, version, err, ErrQuarantined)
+	}
+	if q.isQuarantined(info.Time) {
+		return xerrors.Newf("%s@%s is published at %s: %w", mod, version, info.Time.Format(time.RFC3339), ErrQuarantined)
+	}
+
+	return nil
+}
+
+// publishedTime is the cached result of fetching .info.
+type publishedTime struct {
+	mod  module.Version
+	time time.Time
+	// err is the failure of fetching .info. It is cached until expiresAt.
+	err       error
+	expiresAt time.Time
+}
+
+// info returns .info of the version. The published time is cached because it is never changed.
+// The failure is also cached for quarantineNegativeCacheDuration so that the upstream is not asked every time.
+func (q *Quarantine) info(ctx context.Context, mod, version string) (Info, error) {
+	if v, ok := q.cached(module.Version{Path: mod, Version: version}); ok {
+		return Info{Version: version, Time: v.time}, v.err
+	}
+
+	info, err := q.upstream.GetInfo(ctx, mod, version)
+	if err != nil {
+		if ctx.Err() == nil {
+			q.put(&publishedTime{mod: module.Version{Path: mod, Version: version}, err: err, expiresAt: q.now().Add(quarantineNegativeCacheDuration)})
+		}
+		return Info{}, err
+	}
+	q.record(mod, info)
+	return info, nil
+}
+
+func (q *Quarantine) cached(mod module.Version) (*publishedTime, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	e, ok := q.times[mod]
+	if !ok {
+		return nil, false
+	}
+	v := e.Value.(*publishedTime)
+	if v.err != nil && !q.now().Before(v.expiresAt) {
+		q.lru.Remove(e)
+		delete(q.times, mod)
+		return nil, false
+	}
+	q.lru.MoveToFront(e)
+	return v, true
+}
+
+func (q *Quarantine) record(mod string, info Info) {
+	q.put(&publishedTime{mod: module.Version{Path: mod, Version: info.Version}, time: info.Time})
+}
+
+func (q *Quarantine) put(v *publishedTime) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if e, ok := q.times[v.mod]; ok {
+		e.Value = v
+		q.lru.MoveToFront(e)
+		return
+	}
+	q.times[v.mod] = q.lru.PushFront(v)
+	for q.lru.Len() > q.maxEntries {
+		e := q.lru.Back()
+		q.lru.Remove(e)
+		delete(q.times, e.Value.(*publishedTime).mod)
+	}
+}
+
+// isQuarantined returns true if the version is published in the quarantine period. The unknown time is also quarantined.
+func (q *Quarantine) isQuarantined(published time.Time) bool {
+	return published.IsZero() || q.now().Sub(published) < q.duration
+}
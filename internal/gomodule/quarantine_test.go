@@ -0,0 +1,109 @@
+package gomodule
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQuarantine(t *testing.T) {
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	published := map[string]time.Time{
+		"v1.0.0":      now.Add(-30 * 24 * time.Hour),
+		"v1.1.0":      now.Add(-10 * 24 * time.Hour),
+		"v1.2.0-rc.1": now.Add(-8 * 24 * time.Hour),
+		"v1.2.0":      now.Add(-24 * time.Hour),
+	}
+	u, infoRequests := newTestQuarantineUpstream(t, published)
+
+	q := NewQuarantine(NewUpstream([]*url.URL{u}), 7*24*time.Hour, true, []*regexp.Regexp{regexp.MustCompile(`^example\.com/trusted/`)})
+	q.now = func() time.Time { return now }
+	assert.True(t, q.Applies("example.com/foo"))
+	assert.False(t, q.Applies("example.com/trusted/foo"))
+
+	versions, err := q.Versions(context.Background(), "example.com/foo")
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"v1.0.0", "v1.1.0", "v1.2.0-rc.1"}, versions)
+
+	// The release version takes precedence over the newer pre-release version
+	latest, err := q.Latest(context.Background(), "example.com/foo")
+	require.NoError(t, err)
+	assert.Equal(t, "v1.1.0", latest.Version)
+
+	assert.NoError(t, q.Check(context.Background(), "example.com/foo", "v1.1.0"))
+	assert.True(t, errors.Is(q.Check(context.Background(), "example.com/foo", "v1.2.0"), ErrQuarantined))
+	assert.True(t, errors.Is(q.Check(context.Background(), "example.com/foo", "v9.9.9"), ErrNotFound))
+
+	// The published time and the failure are cached
+	n := infoRequests.Load()
+	_, err = q.Versions(context.Background(), "example.com/foo")
+	require.NoError(t, err)
+	assert.True(t, errors.Is(q.Check(context.Background(), "example.com/foo", "v9.9.9"), ErrNotFound))
+	assert.Equal(t, n, infoRequests.Load())
+	q.now = func() time.Time { return now.Add(quarantineNegativeCacheDuration) }
+	assert.True(t, errors.Is(q.Check(context.Background(), "example.com/foo", "v9.9.9"), ErrNotFound))
+	assert.Equal(t, n+1, infoRequests.Load())
+	q.now = func() time.Time { return now }
+
+	q.blockRequested = false
+	assert.NoError(t, q.Check(context.Background(), "example.com/foo", "v1.2.0"))
+
+	t.Run("CacheSize", func(t *testing.T) {
+		q := NewQuarantine(NewUpstream([]*url.URL{u}), 7*24*time.Hour, true, nil)
+		q.now = func() time.Time { return now }
+		q.maxEntries = 2
+		versions, err := q.Versions(context.Background(), "example.com/foo")
+		require.NoError(t, err)
+		assert.Len(t, versions, 3)
+		assert.Len(t, q.times, 2)
+		assert.Equal(t, 2, q.lru.Len())
+	})
+}
+
+// newTestQuarantineUpstream returns the upstream which serves example.com/foo of the versions published at the time.
+// The number of the requests of .info is counted.
+func newTestQuarantineUpstream(t *testing.T, published map[string]time.Time) (*url.URL, *atomic.Int32) {
+	infoRequests := &atomic.Int32{}
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		p, ok := strings.CutPrefix(req.URL.Path, "/example.com/foo/")
+		if !ok {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		switch {
+		case p == "@v/list":
+			for v := range published {
+				io.WriteString(w, v+"\n")
+			}
+		case p == "@latest":
+			json.NewEncoder(w).Encode(Info{Version: "v1.2.0", Time: published["v1.2.0"]})
+		case strings.HasSuffix(p, ".info"):
+			infoRequests.Add(1)
+			v := strings.TrimSuffix(strings.TrimPrefix(p, "@v/"), ".info")
+			if t, ok := published[v]; ok {
+				json.NewEncoder(w).Encode(Info{Version: v, Time: t})
+				return
+			}
+			http.Error(w, "not found", http.StatusNotFound)
+		default:
+			http.Error(w, "not found", http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(upstream.Close)
+	u, err := url.Parse(upstream.URL)
+	require.NoError(t, err)
+
+	return u, infoRequests
+}
@@ -0,0 +1,330 @@
+package gomodule
+
+import (
+	"bytes"
+	"context"
+	"go/ast"
+	"go/doc"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/go-logr/logr"
+	"go.f110.dev/xerrors"
+)
+
+const (
+	searchDefaultLimit = 20
+	searchMaxLimit     = 100
+	// searchSeedConcurrency is the number of the repositories which are fetched concurrently to seed the index.
+	searchSeedConcurrency = 4
+	// searchIndexConcurrency is the number of the modules which are indexed concurrently.
+	searchIndexConcurrency = 4
+)
+
+// SearchResult is the package which matches the query.
+type SearchResult struct {
+	Module     string `json:"module"`
+	Version    string `json:"version"`
+	ImportPath string `json:"import_path"`
+	Name       string `json:"name"`
+	Synopsis   string `json:"synopsis"`
+	// Symbols are the exported identifiers which match the query.
+	Symbols []string `json:"symbols,omitempty"`
+	Score   int      `json:"score"`
+}
+
+type searchPackage struct {
+	ImportPath string
+	Name       string
+	Synopsis   string
+	Symbols    []string
+}
+
+type searchModule struct {
+	Version  string
+	Packages []searchPackage
+}
+
+// SearchIndex is the index of the packages in the latest version of the private modules.
+// The index has the import paths, the package names, the synopses and the exported identifiers.
+// The index is kept in memory, so it has to be seeded by Seed after the process starts.
+type SearchIndex struct {
+	// ctx is the lifetime of the indexing in the background.
+	ctx     context.Context
+	proxy   *ModuleProxy
+	sem     chan struct{}
+	mu      sync.RWMutex
+	modules map[string]*searchModule
+	// indexing is the set of the modules which are being indexed.
+	indexing map[string]struct{}
+	logger   logr.Logger
+}
+
+// NewSearchIndex returns SearchIndex. The module zip of the version is read from the local clone of proxy.
+// The indexing in the background is canceled when ctx is done.
+func NewSearchIndex(ctx context.Context, proxy *ModuleProxy, logger logr.Logger) *SearchIndex {
+	return &SearchIndex{
+		ctx:      ctx,
+		proxy:    proxy,
+		sem:      make(chan struct{}, searchIndexConcurrency),
+		modules:  make(map[string]*searchModule),
+		indexing: make(map[string]struct{}),
+		logger:   logger,
+	}
+}
+
+// Seed fetches the repositories of the configured modules so that they are indexed by Observe.
+// Observe has to be registered to the proxy as the observer.
+func (s *SearchIndex) Seed(ctx context.Context) {
+	s.proxy.FetchConfiguredModules(ctx, searchSeedConcurrency, func(mod string, err error) {
+		if err != nil {
+			s.logger.Info("Failed to fetch the module", "module", mod, xerrors.ZapField(err))
+		}
+	})
+}
+
+// Add indexes the packages of the module. The existing entries of the module are replaced.
+func (s *SearchIndex) Add(modDoc *ModuleDoc) {
+	m := &searchModule{Version: modDoc.Version}
+	for _, p := range modDoc.Packages {
+		m.Packages = append(m.Packages, searchPackage{
+			ImportPath: p.ImportPath,
+			Name:       p.Doc.Name,
+			Synopsis:   p.Synopsis(),
+			Symbols:    exportedSymbols(p),
+		})
+	}
+
+	s.mu.Lock()
+	s.modules[modDoc.Path] = m
+	s.mu.Unlock()
+}
+
+// Observe indexes the latest version of the modules in the repository in the background.
+// The module whose latest version is already indexed is skipped.
+func (s *SearchIndex) Observe(root *ModuleRoot) {
+	for _, mod := range root.Modules {
+		if len(mod.Versions) == 0 {
+			continue
+		}
+		version := mod.Versions[len(mod.Versions)-1].Semver
+
+		s.mu.Lock()
+		if m, ok := s.modules[mod.Path]; ok && m.Version == version {
+			s.mu.Unlock()
+			continue
+		}
+		if _, ok := s.indexing[mod.Path]; ok {
+			s.mu.Unlock()
+			continue
+		}
+		s.indexing[mod.Path] = struct{}{}
+		s.mu.Unlock()
+
+		// Observe is called while the repository is locked, so the module is indexed in the other goroutine.
+		// The zip is read from root after the other goroutine releases the lock, so the repository is not fetched again.
+		go func(mod *Module, version string) {
+			defer func() {
+				s.mu.Lock()
+				delete(s.indexing, mod.Path)
+				s.mu.Unlock()
+			}()
+
+			select {
+			case s.sem <- struct{}{}:
+			case <-s.ctx.Done():
+				return
+			}
+			defer func() { <-s.sem }()
+
+			if err := s.index(root, mod.Path, version); err != nil {
+				s.logger.Info("Failed to index the module", "module", mod.Path, "version", version, xerrors.ZapField(err))
+			}
+		}(mod, version)
+	}
+}
+
+func (s *SearchIndex) index(root *ModuleRoot, mod, version string) error {
+	if err := s.ctx.Err(); err != nil {
+		return xerrors.WithStack(err)
+	}
+
+	var buf bytes.Buffer
+	if err := s.proxy.fetcher.ArchiveRoot(s.ctx, &buf, root, mod, version); err != nil {
+		return err
+	}
+	modDoc, err := ReadModuleDoc(bytes.NewReader(buf.Bytes()), int64(buf.Len()), mod, version)
+	if err != nil {
+		return err
+	}
+	s.Add(modDoc)
+	s.logger.V(1).Info("Indexed the module", "module", mod, "version", version)
+
+	return nil
+}
+
+// Search returns the packages which match all terms of the query in descending order of the score.
+// The query is matched case-insensitively against the import path, the package name, the synopsis and the exported identifiers.
+// If filter is not nil, the modules which filter returns false are omitted.
+func (s *SearchIndex) Search(query string, limit int, filter func(string) bool) []SearchResult {
+	terms := strings.Fields(strings.ToLower(query))
+	if len(terms) == 0 {
+		return nil
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var results []SearchResult
+	for path, m := range s.modules {
+		if filter != nil && !filter(path) {
+			continue
+		}
+		for _, p := range m.Packages {
+			if r, ok := matchPackage(p, terms); ok {
+				r.Module = path
+				r.Version = m.Version
+				results = append(results, r)
+			}
+		}
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].ImportPath < results[j].ImportPath
+	})
+	if len(results) > limit {
+		results = results[:limit]
+	}
+
+	return results
+}
+
+// matchPackage returns the result if the package matches all terms.
+// The exact match of the package name or the identifier is scored higher than the partial match.
+func matchPackage(p searchPackage, terms []string) (SearchResult, bool) {
+	r := SearchResult{ImportPath: p.ImportPath, Name: p.Name, Synopsis: p.Synopsis}
+	matched := make(map[string]struct{})
+	for _, term := range terms {
+		score := 0
+		if strings.ToLower(p.Name) == term {
+			score += 10
+		} else if strings.Contains(strings.ToLower(p.ImportPath), term) {
+			score += 5
+		}
+		if strings.Contains(strings.ToLower(p.Synopsis), term) {
+			score += 2
+		}
+		for _, sym := range p.Symbols {
+			name := strings.ToLower(sym)
+			// The method is written as Type.Method
+			if _, after, ok := strings.Cut(name, "."); ok && after == term || name == term {
+				score += 8
+			} else if strings.Contains(name, term) {
+				score++
+			} else {
+				continue
+			}
+			if _, ok := matched[sym]; !ok {
+				matched[sym] = struct{}{}
+				r.Symbols = append(r.Symbols, sym)
+			}
+		}
+		if score == 0 {
+			return SearchResult{}, false
+		}
+		r.Score += score
+	}
+	sort.Strings(r.Symbols)
+
+	return r, true
+}
+
+// exportedSymbols returns the exported identifiers of the package. The method is written as Type.Method.
+func exportedSymbols(p *PackageDoc) []string {
+	var symbols []string
+	values := func(values []*doc.Value) {
+		for _, v := range values {
+			for _, spec := range v.Decl.Specs {
+				if vs, ok := spec.(*ast.ValueSpec); ok {
+					for _, n := range vs.Names {
+						if n.IsExported() {
+							symbols = append(symbols, n.Name)
+						}
+					}
+				}
+			}
+		}
+	}
+	values(p.Doc.Consts)
+	values(p.Doc.Vars)
+	for _, f := range p.Doc.Funcs {
+		symbols = append(symbols, f.Name)
+	}
+	for _, t := range p.Doc.Types {
+		symbols = append(symbols, t.Name)
+		values(t.Consts)
+		values(t.Vars)
+		for _, f := range t.Funcs {
+			symbols = append(symbols, f.Name)
+		}
+		for _, f := range t.Methods {
+			symbols = append(symbols, t.Name+"."+f.Name)
+		}
+	}
+
+	return symbols
+}
+
+// SearchHandler serves the search API.
+//
+//	GET /_search?q=...&limit=20
+//
+// The response is the list of SearchResult in JSON. The modules which the client can not access are omitted.
+type SearchHandler struct {
+	index  *SearchIndex
+	proxy  *ModuleProxy
+	auth   *Authenticator
+	logger logr.Logger
+}
+
+// NewSearchHandler returns SearchHandler. If auth is nil, the clients are not authenticated.
+func NewSearchHandler(index *SearchIndex, proxy *ModuleProxy, auth *Authenticator, logger logr.Logger) *SearchHandler {
+	return &SearchHandler{index: index, proxy: proxy, auth: auth, logger: logger}
+}
+
+func (h *SearchHandler) Handler() http.Handler {
+	return middlewareBrowserAuth(h.auth)(http.HandlerFunc(h.search))
+}
+
+func (h *SearchHandler) search(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, xerrors.New("method not allowed"))
+		return
+	}
+	q := req.URL.Query().Get("q")
+	if strings.TrimSpace(q) == "" {
+		writeJSONError(w, http.StatusBadRequest, xerrors.New("q is required"))
+		return
+	}
+	limit := searchDefaultLimit
+	if v := req.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			writeJSONError(w, http.StatusBadRequest, xerrors.New("malformed limit"))
+			return
+		}
+		limit = min(n, searchMaxLimit)
+	}
+
+	id := IdentityFromContext(req.Context())
+	results := h.index.Search(q, limit, func(mod string) bool { return h.proxy.IsAllowed(mod, id) })
+	if results == nil {
+		results = []SearchResult{}
+	}
+	writeJSON(w, http.StatusOK, results)
+}
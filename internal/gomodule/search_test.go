@@ -0,0 +1,97 @@
+package gomodule
+
+import (
+	"bytes"
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSearchIndex(t *testing.T) {
+	idx := NewSearchIndex(context.Background(), nil, logr.Discard())
+	for mod, files := range map[string]map[string]string{
+		"example.com/storage": {
+			"go.mod":      "module example.com/storage\n",
+			"storage.go":  "// Package storage provides the object storage client.\npackage storage\n\ntype Client struct{}\n\nfunc NewClient() *Client { return nil }\n\nfunc (c *Client) PutObject() error { return nil }\n",
+			"s3/s3.go":    "// Package s3 is the backend of S3.\npackage s3\n\nconst DefaultRegion = \"us-east-1\"\n",
+			"internal.go": "package storage\n\nfunc helper() {}\n",
+		},
+		"example.com/secret": {
+			"go.mod":    "module example.com/secret\n",
+			"secret.go": "// Package secret stores the objects.\npackage secret\n\nfunc PutObject() {}\n",
+		},
+	} {
+		buf := newTestModuleZip(t, mod, "v1.0.0", files)
+		modDoc, err := ReadModuleDoc(bytes.NewReader(buf), int64(len(buf)), mod, "v1.0.0")
+		require.NoError(t, err)
+		idx.Add(modDoc)
+	}
+
+	results := idx.Search("PutObject", 10, nil)
+	require.Len(t, results, 2)
+	// The results of the same score are sorted by the import path
+	assert.Equal(t, "example.com/secret", results[0].ImportPath)
+	assert.Equal(t, "example.com/storage", results[1].ImportPath)
+	assert.Equal(t, []string{"Client.PutObject"}, results[1].Symbols)
+
+	// All terms have to match
+	results = idx.Search("storage region", 10, nil)
+	require.Len(t, results, 1)
+	assert.Equal(t, "example.com/storage/s3", results[0].ImportPath)
+	assert.Equal(t, "v1.0.0", results[0].Version)
+
+	// The unexported identifier is not indexed
+	assert.Empty(t, idx.Search("helper", 10, nil))
+	assert.Len(t, idx.Search("object", 1, nil), 1)
+	results = idx.Search("object", 10, func(mod string) bool { return mod != "example.com/secret" })
+	require.Len(t, results, 1)
+	assert.Equal(t, "example.com/storage", results[0].Module)
+}
+
+func TestSearchIndex_Seed(t *testing.T) {
+	dir := newTestGitRepository(t, map[string]string{
+		"go.mod":     "module example.com/storage\n",
+		"storage.go": "// Package storage provides the object storage client.\npackage storage\n\nfunc PutObject() {}\n",
+	}, "v1.0.0")
+	proxy := NewModuleProxy([]*ModuleRule{
+		{Match: regexp.MustCompile(`^example\.com/storage(/|$)`), Repository: dir, Prefix: "example.com/storage"},
+	}, t.TempDir(), time.Hour, nil, nil, nil)
+	idx := NewSearchIndex(context.Background(), proxy, logr.Discard())
+	proxy.AddObserver(idx.Observe)
+
+	// The configured modules are indexed without any request to the proxy
+	idx.Seed(context.Background())
+	require.Eventually(t, func() bool { return len(idx.Search("PutObject", 10, nil)) == 1 }, 5*time.Second, 10*time.Millisecond)
+	results := idx.Search("PutObject", 10, nil)
+	assert.Equal(t, "example.com/storage", results[0].ImportPath)
+	assert.Equal(t, "v1.0.0", results[0].Version)
+}
+
+func TestSearchIndex_Canceled(t *testing.T) {
+	dir := newTestGitRepository(t, map[string]string{
+		"go.mod":     "module example.com/storage\n",
+		"storage.go": "// Package storage provides the object storage client.\npackage storage\n\nfunc PutObject() {}\n",
+	}, "v1.0.0")
+	proxy := NewModuleProxy([]*ModuleRule{
+		{Match: regexp.MustCompile(`^example\.com/storage(/|$)`), Repository: dir, Prefix: "example.com/storage"},
+	}, t.TempDir(), time.Hour, nil, nil, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	idx := NewSearchIndex(ctx, proxy, logr.Discard())
+	proxy.AddObserver(idx.Observe)
+
+	// The module is not indexed after the server is shutting down
+	_, err := proxy.ModuleRoot(context.Background(), "example.com/storage")
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		idx.mu.RLock()
+		defer idx.mu.RUnlock()
+		return len(idx.indexing) == 0
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Empty(t, idx.Search("PutObject", 10, nil))
+}
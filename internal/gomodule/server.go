@@ -2,6 +2,7 @@ package gomodule
 
 import (
 	"context"
+	"crypto/tls"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -9,41 +10,83 @@ import (
 	"net/http"
 	"net/http/httputil"
 	"net/url"
+	"os"
+	"strings"
+	"time"
 
 	"github.com/go-logr/logr"
 	"github.com/gorilla/mux"
 	"go.f110.dev/xerrors"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/mod/module"
 )
 
+// ServerTimeouts is the timeouts of http.Server. Zero means no timeout.
+type ServerTimeouts struct {
+	ReadHeader time.Duration
+	Read       time.Duration
+	Write      time.Duration
+	Idle       time.Duration
+}
+
 type ProxyServer struct {
-	s     *http.Server
-	rr    *httputil.ReverseProxy
-	r     *mux.Router
-	proxy *ModuleProxy
+	s          *http.Server
+	rr         *httputil.ReverseProxy
+	upstream   *Upstream
+	quarantine *Quarantine
+	r          *mux.Router
+	proxy      *ModuleProxy
+	auth       *Authenticator
 
-	logger logr.Logger
-	debug  bool
+	metrics     *Metrics
+	logger      logr.Logger
+	auditLogger logr.Logger
+	debug       bool
 }
 
-func NewProxyServer(addr string, upstream *url.URL, proxy *ModuleProxy, logger logr.Logger, debug bool) *ProxyServer {
+// NewProxyServer returns the server.
+// The module which is not served by proxy is forwarded to the upstreams in order.
+func NewProxyServer(addr string, tlsConfig *tls.Config, timeouts ServerTimeouts, upstreams []*url.URL, proxy *ModuleProxy, auth *Authenticator, metrics *Metrics, health *HealthChecker, accessLogFormat AccessLogFormat, logger logr.Logger, debug bool) *ProxyServer {
 	s := &ProxyServer{
-		r:      mux.NewRouter(),
-		rr:     httputil.NewSingleHostReverseProxy(upstream),
-		proxy:  proxy,
-		logger: logger,
-		debug:  debug,
+		r:           mux.NewRouter(),
+		rr:          newReverseProxy(upstreams),
+		upstream:    NewUpstream(upstreams),
+		proxy:       proxy,
+		auth:        auth,
+		metrics:     metrics,
+		logger:      logger,
+		auditLogger: logger.WithName("audit"),
+		debug:       debug,
 	}
+	s.rr.ErrorHandler = s.upstreamErrorHandler
+	// The access log wraps the router so that the requests which don't match any route are logged too
+	handler := middlewareAccessLog(logger.WithName("access_log"), accessLogFormat, os.Stdout)(s.r)
 	s.s = &http.Server{
-		Addr:    addr,
-		Handler: s.r,
+		Addr:              addr,
+		Handler:           handler,
+		TLSConfig:         tlsConfig,
+		ReadHeaderTimeout: timeouts.ReadHeader,
+		ReadTimeout:       timeouts.Read,
+		WriteTimeout:      timeouts.Write,
+		IdleTimeout:       timeouts.Idle,
 	}
 
-	s.r.Methods(http.MethodGet).Path("/{module:.+}/@v/list").HandlerFunc(s.handle(s.list))
-	s.r.Methods(http.MethodGet).Path("/{module:.+}/@v/{version}.info").HandlerFunc(s.handle(s.info))
-	s.r.Methods(http.MethodGet).Path("/{module:.+}/@v/{version}.mod").HandlerFunc(s.handle(s.mod))
-	s.r.Methods(http.MethodGet).Path("/{module:.+}/@v/{version}.zip").HandlerFunc(s.handle(s.zip))
-	s.r.Methods(http.MethodGet).Path("/{module:.+}/@latest").HandlerFunc(s.handle(s.latest))
-	s.r.Use(middlewareAccessLog(logger.WithName("access_log")))
+	if metrics != nil {
+		s.r.Methods(http.MethodGet).Path("/metrics").Handler(metrics.Handler())
+	}
+	if health != nil {
+		s.r.Methods(http.MethodGet).Path("/healthz").HandlerFunc(health.Liveness)
+		s.r.Methods(http.MethodGet).Path("/readyz").HandlerFunc(health.Readiness)
+	}
+	s.r.Methods(http.MethodGet).Path("/{module:.+}/@v/list").HandlerFunc(s.handle("list", s.list))
+	s.r.Methods(http.MethodGet).Path("/{module:.+}/@v/{version}.info").HandlerFunc(s.handle("info", s.info))
+	s.r.Methods(http.MethodGet).Path("/{module:.+}/@v/{version}.mod").HandlerFunc(s.handle("mod", s.mod))
+	s.r.Methods(http.MethodGet).Path("/{module:.+}/@v/{version}.zip").HandlerFunc(s.handle("zip", s.zip))
+	s.r.Methods(http.MethodGet).Path("/{module:.+}/@latest").HandlerFunc(s.handle("latest", s.latest))
 	if debug {
 		s.r.Use(middlewareDebugInfo)
 	}
@@ -51,9 +94,58 @@ func NewProxyServer(addr string, upstream *url.URL, proxy *ModuleProxy, logger l
 	return s
 }
 
+func newReverseProxy(upstreams []*url.URL) *httputil.ReverseProxy {
+	return &httputil.ReverseProxy{
+		Director: func(req *http.Request) {
+			// The destination is decided by fallbackTransport
+			req.URL.Scheme = upstreams[0].Scheme
+			req.URL.Host = upstreams[0].Host
+			// The credentials of this proxy must not be sent to the upstreams
+			req.Header.Del("Authorization")
+			req.Header.Del("Proxy-Authorization")
+			if _, ok := req.Header["User-Agent"]; !ok {
+				// Prevent the default value from being set by net/http
+				req.Header.Set("User-Agent", "")
+			}
+		},
+		Transport: &fallbackTransport{upstreams: upstreams, base: newTracingTransport(http.DefaultTransport)},
+	}
+}
+
+// Mount registers the handler for the path prefix.
+// The handler is served without the authentication of the clients, so the handler has to authenticate the request itself.
+// It must be called before Start.
+func (s *ProxyServer) Mount(prefix string, handler http.Handler) {
+	s.r.PathPrefix(prefix).Handler(handler)
+}
+
+// Handle registers the handler for the exact path.
+// Like Mount, the handler is served without the authentication of the clients. It must be called before Start.
+func (s *ProxyServer) Handle(path string, handler http.Handler) {
+	s.r.Path(path).Handler(handler)
+}
+
+// HandleGoGet registers the handler for the go-get requests (?go-get=1).
+// Like Mount, the handler is served without the authentication of the clients. It must be called before Start.
+func (s *ProxyServer) HandleGoGet(handler http.Handler) {
+	s.r.Methods(http.MethodGet).Queries("go-get", "1").Handler(handler)
+}
+
+// SetQuarantine enables the quarantine of the new versions of the upstream modules.
+func (s *ProxyServer) SetQuarantine(q *Quarantine) {
+	s.quarantine = q
+}
+
 func (s *ProxyServer) Start() error {
-	s.logger.Info("Starting listening", "addr", s.s.Addr)
-	if err := s.s.ListenAndServe(); err != nil {
+	s.logger.Info("Starting listening", "addr", s.s.Addr, "tls", s.s.TLSConfig != nil)
+	var err error
+	if s.s.TLSConfig != nil {
+		// The certificate is provided by TLSConfig.GetCertificate
+		err = s.s.ListenAndServeTLS("", "")
+	} else {
+		err = s.s.ListenAndServe()
+	}
+	if err != nil {
 		if errors.Is(err, http.ErrServerClosed) {
 			return nil
 		}
@@ -71,22 +163,270 @@ func (s *ProxyServer) Stop(ctx context.Context) error {
 	return nil
 }
 
-func (s *ProxyServer) handle(h func(w http.ResponseWriter, req *http.Request, module, version string)) http.HandlerFunc {
+func (s *ProxyServer) handle(endpoint string, h func(w http.ResponseWriter, req *http.Request, module, version string)) http.HandlerFunc {
 	return func(w http.ResponseWriter, req *http.Request) {
 		vars := mux.Vars(req)
 		if v, ok := vars["module"]; !ok || v == "" {
 			http.Error(w, "bad request", http.StatusBadRequest)
 			return
 		}
-		if s.proxy.IsProxy(vars["module"]) {
-			h(w, req, vars["module"], vars["version"])
+		// The module path in the URL is escaped (e.g. github.com/!foo/bar). The rules are matched against the module path.
+		mod, err := module.UnescapePath(vars["module"])
+		if err != nil {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+
+		route := routeUpstream
+		if s.proxy.IsProxy(mod) {
+			route = routePrivate
+		}
+		info := requestInfoFromContext(req.Context())
+		info.Route = route
+		info.Module = mod
+		info.Version = vars["version"]
+		if s.auth != nil {
+			id, err := s.auth.Authenticate(req)
+			switch {
+			case err == nil:
+				info.User = id.Name
+				req = req.WithContext(withIdentity(req.Context(), id))
+			case errors.Is(err, ErrUnauthorized) && s.auth.AllowAnonymous(route):
+			default:
+				w.Header().Set("WWW-Authenticate", `Basic realm="gomodule-proxy"`)
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+		}
+		if !s.proxy.IsAllowed(mod, IdentityFromContext(req.Context())) {
+			s.auditLogger.Info("Access denied",
+				"request_id", info.ID,
+				"user", info.User,
+				"module", mod,
+				"path", req.URL.Path,
+				"remote_addr", req.RemoteAddr,
+			)
+			// Respond 404 instead of 403 so that the existence of the module is not leaked
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		s.metrics.IncInFlight()
+		rw := newResponseWriter(w)
+		t1 := time.Now()
+		ctx := otel.GetTextMapPropagator().Extract(req.Context(), propagation.HeaderCarrier(req.Header))
+		ctx, span := tracer.Start(ctx, "ProxyServer."+endpoint,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("route", route),
+				attribute.String("module", mod),
+				attribute.String("version", vars["version"]),
+			),
+		)
+		req = req.WithContext(ctx)
+		defer func() {
+			span.SetAttributes(attribute.Int("http.response.status_code", rw.status))
+			if rw.status >= http.StatusInternalServerError {
+				span.SetStatus(codes.Error, http.StatusText(rw.status))
+			}
+			span.End()
+			s.metrics.DecInFlight()
+			s.metrics.ObserveRequest(endpoint, route, rw.status, time.Since(t1))
+			if endpoint == "zip" {
+				s.metrics.AddZipBytes(route, rw.written)
+			}
+		}()
+
+		if route == routePrivate {
+			h(rw, req, mod, vars["version"])
+			return
+		}
+		if s.proxy.IsFork(mod) {
+			if s.serveFork(rw, req, endpoint, mod, vars["version"]) {
+				return
+			}
+		}
+		// The quarantine is applied to the imported artifacts too
+		if s.quarantine != nil && s.quarantine.Applies(mod) {
+			if s.serveQuarantine(rw, req, endpoint, mod, vars["version"]) {
+				return
+			}
+		}
+		// The artifact which is imported into the storage takes precedence over the upstream
+		if s.serveFromCache(rw, endpoint, vars["module"], vars["version"]) {
 			return
 		}
 
-		s.rr.ServeHTTP(w, req)
+		s.rr.ServeHTTP(rw, req)
 	}
 }
 
+// serveFromCache serves the artifact of the module from the cache. It returns false if the artifact is not cached.
+// The path and the version in the URL are escaped.
+func (s *ProxyServer) serveFromCache(w http.ResponseWriter, endpoint, escapedPath, escapedVersion string) bool {
+	switch endpoint {
+	case ArtifactInfo, ArtifactMod, ArtifactZip:
+	default:
+		return false
+	}
+	mod, err := module.UnescapePath(escapedPath)
+	if err != nil {
+		return false
+	}
+	ver, err := module.UnescapeVersion(escapedVersion)
+	if err != nil {
+		return false
+	}
+	f, err := s.proxy.cache.Open(mod, ver, endpoint)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	if _, err := io.Copy(w, f); err != nil {
+		s.logger.Info("Failed to write the cached artifact", "module", mod, "version", ver, xerrors.ZapField(err))
+	}
+	return true
+}
+
+// serveFork serves the versions of the module which are substituted by the fork.
+// The list is merged with the versions of the upstream. It returns false if the request should be forwarded to the upstream.
+func (s *ProxyServer) serveFork(w http.ResponseWriter, req *http.Request, endpoint, mod, escapedVersion string) bool {
+	if endpoint == "list" {
+		forkVersions, err := s.proxy.ForkVersions(req.Context(), mod)
+		if err != nil {
+			s.logger.Info("Failed to get versions of the fork", "module", mod, xerrors.ZapField(err))
+			return false
+		}
+		versions, err := s.upstreamVersions(req.Context(), mod)
+		if err != nil {
+			s.logger.Info("Failed to get versions from the upstream", "module", mod, xerrors.ZapField(err))
+		}
+		for _, v := range append(versions, forkVersions...) {
+			fmt.Fprintln(w, v)
+		}
+		return true
+	}
+
+	ver, err := module.UnescapeVersion(escapedVersion)
+	if err != nil {
+		return false
+	}
+	switch endpoint {
+	case ArtifactInfo:
+		var info Info
+		info, err = s.proxy.GetForkInfo(req.Context(), mod, ver)
+		if err == nil {
+			err = json.NewEncoder(w).Encode(info)
+		}
+	case ArtifactMod:
+		var goMod string
+		goMod, err = s.proxy.GetForkGoMod(req.Context(), mod, ver)
+		if err == nil {
+			_, err = io.WriteString(w, goMod)
+		}
+	case ArtifactZip:
+		err = s.proxy.GetForkZip(req.Context(), w, mod, ver)
+	default:
+		// The latest version is always resolved by the upstream
+		return false
+	}
+	if errors.Is(err, ErrNotForked) {
+		return false
+	}
+	if err != nil {
+		s.logger.Info("Failed to serve the fork", "module", mod, "version", ver, "endpoint", endpoint, xerrors.ZapField(err))
+		http.Error(w, "", http.StatusInternalServerError)
+	}
+	return true
+}
+
+// serveQuarantine filters the versions which are in the quarantine period out of list and @latest.
+// The version which is requested explicitly is responded 410 if the policy blocks it.
+// It returns false if the request should be forwarded to the upstream.
+func (s *ProxyServer) serveQuarantine(w http.ResponseWriter, req *http.Request, endpoint, mod, escapedVersion string) bool {
+	switch endpoint {
+	case "list":
+		versions, err := s.quarantine.Versions(req.Context(), mod)
+		if err != nil {
+			s.quarantineError(w, req, err)
+			return true
+		}
+		for _, v := range versions {
+			fmt.Fprintln(w, v)
+		}
+	case "latest":
+		info, err := s.quarantine.Latest(req.Context(), mod)
+		if err != nil {
+			s.quarantineError(w, req, err)
+			return true
+		}
+		requestInfoFromContext(req.Context()).Version = info.Version
+		if err := json.NewEncoder(w).Encode(info); err != nil {
+			s.logger.Info("Failed to encode to json", xerrors.ZapField(err))
+		}
+	default:
+		ver, err := module.UnescapeVersion(escapedVersion)
+		if err != nil {
+			return false
+		}
+		err = s.quarantine.Check(req.Context(), mod, ver)
+		if !errors.Is(err, ErrQuarantined) {
+			return false
+		}
+		s.logger.Info("Blocked the quarantined version", "module", mod, "version", ver, xerrors.ZapField(err))
+		http.Error(w, err.Error(), http.StatusGone)
+	}
+
+	return true
+}
+
+func (s *ProxyServer) quarantineError(w http.ResponseWriter, req *http.Request, err error) {
+	switch {
+	case errors.Is(err, ErrQuarantined):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, ErrNotFound):
+		http.Error(w, "not found", http.StatusNotFound)
+	default:
+		s.upstreamErrorHandler(w, req, err)
+	}
+}
+
+// upstreamVersions returns the versions of the module in the upstream. The quarantined versions are excluded.
+func (s *ProxyServer) upstreamVersions(ctx context.Context, mod string) ([]string, error) {
+	if s.quarantine != nil && s.quarantine.Applies(mod) {
+		return s.quarantine.Versions(ctx, mod)
+	}
+
+	return s.upstream.Versions(ctx, mod)
+}
+
+// upstreamErrorHandler serves the list and the latest version from the cache when the upstream is not reachable.
+func (s *ProxyServer) upstreamErrorHandler(w http.ResponseWriter, req *http.Request, err error) {
+	info := requestInfoFromContext(req.Context())
+	if mod, uErr := module.UnescapePath(info.Module); uErr == nil {
+		switch {
+		case strings.HasSuffix(req.URL.Path, "/@v/list"):
+			if versions, cErr := s.proxy.cache.List(mod); cErr == nil {
+				for _, v := range versions {
+					fmt.Fprintln(w, v)
+				}
+				return
+			}
+		case strings.HasSuffix(req.URL.Path, "/@latest"):
+			if latest, cErr := s.proxy.cache.Latest(mod); cErr == nil {
+				info.Version = latest.Version
+				if err := json.NewEncoder(w).Encode(latest); err != nil {
+					s.logger.Info("Failed to encode to json", xerrors.ZapField(err))
+				}
+				return
+			}
+		}
+	}
+
+	s.logger.Info("Failed to proxy the request to the upstream", "path", req.URL.Path, xerrors.ZapField(err))
+	w.WriteHeader(http.StatusBadGateway)
+}
+
 func (s *ProxyServer) list(w http.ResponseWriter, req *http.Request, module, _ string) {
 	vers, err := s.proxy.Versions(req.Context(), module)
 	if err != nil {
@@ -142,36 +482,48 @@ func (s *ProxyServer) latest(w http.ResponseWriter, req *http.Request, module, _
 		http.Error(w, "", http.StatusBadRequest)
 		return
 	}
+	requestInfoFromContext(req.Context()).Version = info.Version
 	if err := json.NewEncoder(w).Encode(info); err != nil {
 		s.logger.Info("Failed to encode to json", xerrors.ZapField(err))
 		return
 	}
 }
 
-func middlewareAccessLog(logger logr.Logger) func(next http.Handler) http.Handler {
-	return func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
-			logger.Info(
-				"",
-				"host",
-				req.Host,
-				"protocol",
-				req.Proto,
-				"method",
-				req.Method,
-				"path",
-				req.URL.Path,
-				"remote_addr",
-				req.RemoteAddr,
-				"ua",
-				req.Header.Get("User-Agent"),
-			)
+// responseWriter records the status code and the number of bytes written to the underlying http.ResponseWriter.
+type responseWriter struct {
+	http.ResponseWriter
 
-			next.ServeHTTP(w, req)
-		})
+	status  int
+	written int64
+}
+
+var _ http.ResponseWriter = &responseWriter{}
+
+func newResponseWriter(w http.ResponseWriter) *responseWriter {
+	return &responseWriter{ResponseWriter: w, status: http.StatusOK}
+}
+
+func (w *responseWriter) WriteHeader(code int) {
+	w.status = code
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *responseWriter) Write(b []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(b)
+	w.written += int64(n)
+	return n, err
+}
+
+func (w *responseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
 	}
 }
 
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
 func middlewareDebugInfo(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
 		vars := mux.Vars(req)
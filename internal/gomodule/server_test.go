@@ -0,0 +1,163 @@
+package gomodule
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestProxyServer(upstream *url.URL, proxy *ModuleProxy) *ProxyServer {
+	return NewProxyServer("", nil, ServerTimeouts{}, []*url.URL{upstream}, proxy, nil, nil, nil, AccessLogFormatLogger, logr.Discard(), false)
+}
+
+func getTestProxyServer(s *ProxyServer, path string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	s.r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	return rec
+}
+
+func TestProxyServer_Quarantine(t *testing.T) {
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	upstream, _ := newTestQuarantineUpstream(t, map[string]time.Time{
+		"v1.1.0": now.Add(-10 * 24 * time.Hour),
+		"v1.2.0": now.Add(-24 * time.Hour),
+	})
+
+	// The artifacts are imported into the storage
+	cache := NewArtifactCache(t.TempDir())
+	for _, v := range []string{"v1.1.0", "v1.2.0"} {
+		err := cache.Put("example.com/foo", v, ArtifactMod, func(w io.Writer) error {
+			_, err := io.WriteString(w, "module example.com/foo\n")
+			return err
+		})
+		require.NoError(t, err)
+	}
+	s := newTestProxyServer(upstream, NewModuleProxy(nil, t.TempDir(), 0, cache, nil, nil))
+	q := NewQuarantine(NewUpstream([]*url.URL{upstream}), 7*24*time.Hour, true, nil)
+	q.now = func() time.Time { return now }
+	s.SetQuarantine(q)
+
+	rec := getTestProxyServer(s, "/example.com/foo/@v/list")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "v1.1.0\n", rec.Body.String())
+
+	rec = getTestProxyServer(s, "/example.com/foo/@latest")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"Version":"v1.1.0"`)
+
+	rec = getTestProxyServer(s, "/example.com/foo/@v/v1.1.0.mod")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "module example.com/foo\n", rec.Body.String())
+
+	// The cached artifact of the quarantined version is blocked too
+	rec = getTestProxyServer(s, "/example.com/foo/@v/v1.2.0.mod")
+	assert.Equal(t, http.StatusGone, rec.Code)
+	assert.Contains(t, rec.Body.String(), "quarantined")
+}
+
+func TestProxyServer_Fork(t *testing.T) {
+	upstream := newTestUpstream(t, map[string]string{
+		"github.com/upstream/foo@v1.0.0": "module github.com/upstream/foo\n",
+		"github.com/upstream/foo@v1.1.0": "module github.com/upstream/foo\n",
+	})
+	proxy := NewModuleProxy(nil, t.TempDir(), 0, nil, nil, nil)
+	proxy.SetForks([]*ForkRule{{Module: "github.com/upstream/foo", Repository: "https://github.com/me/foo", MaxVersion: "v1.1.0"}})
+	setTestModuleRoot(proxy, &ModuleRoot{
+		RootPath: "github.com/me/foo",
+		Modules: []*Module{
+			{Path: "github.com/upstream/foo", modFilePath: "go.mod", Versions: []*ModuleVersion{
+				{Version: "v1.0.1", Semver: "v1.0.1", Time: time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC), Commit: "0123456789abcdef"},
+				// Out of the range
+				{Version: "v1.1.1", Semver: "v1.1.1"},
+			}},
+		},
+	})
+	s := newTestProxyServer(upstream, proxy)
+
+	rec := getTestProxyServer(s, "/github.com/upstream/foo/@v/list")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.ElementsMatch(t, []string{"v1.0.0", "v1.1.0", "v1.0.1-fork"}, strings.Fields(rec.Body.String()))
+
+	rec = getTestProxyServer(s, "/github.com/upstream/foo/@v/v1.0.1-fork.info")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var info Info
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &info))
+	assert.Equal(t, "v1.0.1-fork", info.Version)
+	require.NotNil(t, info.Fork)
+	assert.Equal(t, ForkInfo{Repository: "https://github.com/me/foo", Tag: "v1.0.1", Commit: "0123456789abcdef"}, *info.Fork)
+
+	// The version which is not forked is served by the upstream
+	rec = getTestProxyServer(s, "/github.com/upstream/foo/@v/v1.1.0.info")
+	require.Equal(t, http.StatusOK, rec.Code)
+	info = Info{}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &info))
+	assert.Equal(t, "v1.1.0", info.Version)
+	assert.Nil(t, info.Fork)
+}
+
+func TestProxyServer_ForkUnavailable(t *testing.T) {
+	upstream := newTestUpstream(t, map[string]string{
+		"github.com/upstream/foo@v1.0.0": "module github.com/upstream/foo\n",
+	})
+	proxy := NewModuleProxy(nil, t.TempDir(), 0, nil, nil, nil)
+	// The repository of the fork can not be fetched
+	proxy.SetForks([]*ForkRule{{Module: "github.com/upstream/foo", Repository: filepath.Join(t.TempDir(), "not-found")}})
+	s := newTestProxyServer(upstream, proxy)
+
+	// The version which is not forked is served by the upstream without fetching the fork
+	rec := getTestProxyServer(s, "/github.com/upstream/foo/@v/v1.0.0.info")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	rec = getTestProxyServer(s, "/github.com/upstream/foo/@v/v1.0.0.mod")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Empty(t, proxy.Repositories())
+	rec = getTestProxyServer(s, "/github.com/upstream/foo/@v/list")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, []string{"v1.0.0"}, strings.Fields(rec.Body.String()))
+
+	rec = getTestProxyServer(s, "/github.com/upstream/foo/@v/v1.0.0-fork.info")
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+}
+
+func TestProxyServer_EscapedPath(t *testing.T) {
+	upstream := newTestUpstream(t, nil)
+	auth, err := NewAuthenticator([]BearerToken{{Name: "alice", Token: "alice-token"}, {Name: "bob", Token: "bob-token"}}, nil, nil, nil, true)
+	require.NoError(t, err)
+	proxy := NewModuleProxy([]*ModuleRule{{Match: regexp.MustCompile(`^example.com/Private(/|$)`), AllowedUsers: []string{"alice"}}}, t.TempDir(), 0, nil, nil, nil)
+	setTestModuleRoot(proxy, &ModuleRoot{
+		RootPath: "example.com/Private",
+		Modules: []*Module{
+			{Path: "example.com/Private", Versions: []*ModuleVersion{{Version: "v1.0.0", Semver: "v1.0.0"}}},
+		},
+	})
+	s := NewProxyServer("", nil, ServerTimeouts{}, []*url.URL{upstream}, proxy, auth, nil, nil, AccessLogFormatLogger, logr.Discard(), false)
+
+	// The rule is matched against the unescaped module path
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/example.com/!private/@v/list", nil)
+	req.Header.Set("Authorization", "Bearer alice-token")
+	s.r.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, []string{"v1.0.0"}, strings.Fields(rec.Body.String()))
+
+	rec = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodGet, "/example.com/!private/@v/list", nil)
+	req.Header.Set("Authorization", "Bearer bob-token")
+	s.r.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Contains(t, rec.Body.String(), "not found")
+
+	// The path which can not be unescaped
+	rec = getTestProxyServer(s, "/example.com/Private/@v/list")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
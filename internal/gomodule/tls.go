@@ -0,0 +1,119 @@
+package gomodule
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"os"
+	"sync"
+	"time"
+
+	"go.f110.dev/xerrors"
+)
+
+const certificateCheckInterval = 10 * time.Second
+
+// NewTLSConfig returns tls.Config which reloads the certificate when the files are rotated.
+// If clientCAFile is not empty, the client certificate is verified by the CA bundle.
+func NewTLSConfig(certFile, keyFile, clientCAFile string, requireClientCert bool) (*tls.Config, error) {
+	reloader, err := newCertificateReloader(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	conf := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		NextProtos:     []string{"h2", "http/1.1"},
+		GetCertificate: reloader.GetCertificate,
+	}
+	if clientCAFile != "" {
+		buf, err := os.ReadFile(clientCAFile)
+		if err != nil {
+			return nil, xerrors.WithStack(err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(buf) {
+			return nil, xerrors.Newf("%s doesn't have any certificate", clientCAFile)
+		}
+		conf.ClientCAs = pool
+		conf.ClientAuth = tls.VerifyClientCertIfGiven
+		if requireClientCert {
+			conf.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	}
+
+	return conf, nil
+}
+
+// certificateReloader loads the certificate again when the modification time of the files is changed.
+type certificateReloader struct {
+	certFile string
+	keyFile  string
+
+	mu        sync.Mutex
+	cert      *tls.Certificate
+	modTime   time.Time
+	checkedAt time.Time
+}
+
+func newCertificateReloader(certFile, keyFile string) (*certificateReloader, error) {
+	r := &certificateReloader{certFile: certFile, keyFile: keyFile}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func (r *certificateReloader) GetCertificate(_ *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if time.Since(r.checkedAt) > certificateCheckInterval {
+		r.checkedAt = time.Now()
+		if modTime, err := r.lastModified(); err == nil && !modTime.Equal(r.modTime) {
+			// Keep serving the current certificate if the new one is broken (e.g. in the middle of rotation)
+			_ = r.loadLocked()
+		}
+	}
+
+	return r.cert, nil
+}
+
+func (r *certificateReloader) load() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.loadLocked()
+}
+
+func (r *certificateReloader) loadLocked() error {
+	modTime, err := r.lastModified()
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return xerrors.WithStack(err)
+	}
+	r.cert = &cert
+	r.modTime = modTime
+	r.checkedAt = time.Now()
+
+	return nil
+}
+
+// lastModified returns the latest modification time of the certificate and the key.
+func (r *certificateReloader) lastModified() (time.Time, error) {
+	var latest time.Time
+	for _, v := range []string{r.certFile, r.keyFile} {
+		fi, err := os.Stat(v)
+		if err != nil {
+			return time.Time{}, xerrors.WithStack(err)
+		}
+		if fi.ModTime().After(latest) {
+			latest = fi.ModTime()
+		}
+	}
+
+	return latest, nil
+}
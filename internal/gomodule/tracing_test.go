@@ -0,0 +1,148 @@
+package gomodule
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.f110.dev/xerrors"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	testSpanRecorderOnce sync.Once
+	testSpanRecorder     *tracetest.SpanRecorder
+)
+
+// newTestSpanRecorder returns the recorder of the spans which are started by tracer.
+// The global TracerProvider is set only once because tracer keeps using the provider which is set first.
+func newTestSpanRecorder() *tracetest.SpanRecorder {
+	testSpanRecorderOnce.Do(func() {
+		testSpanRecorder = tracetest.NewSpanRecorder()
+		otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(testSpanRecorder)))
+		otel.SetTextMapPropagator(propagation.TraceContext{})
+	})
+	testSpanRecorder.Reset()
+
+	return testSpanRecorder
+}
+
+func findTestSpan(t *testing.T, spans []sdktrace.ReadOnlySpan, name string) sdktrace.ReadOnlySpan {
+	t.Helper()
+
+	for _, v := range spans {
+		if v.Name() == name {
+			return v
+		}
+	}
+	require.Failf(t, "span is not found", "%s", name)
+	return nil
+}
+
+func spanAttribute(span sdktrace.ReadOnlySpan, key attribute.Key) attribute.Value {
+	for _, v := range span.Attributes() {
+		if v.Key == key {
+			return v.Value
+		}
+	}
+	return attribute.Value{}
+}
+
+type errorTransport struct{}
+
+func (errorTransport) RoundTrip(_ *http.Request) (*http.Response, error) {
+	return nil, xerrors.New("connection refused")
+}
+
+func TestTracingTransport(t *testing.T) {
+	recorder := newTestSpanRecorder()
+
+	var received trace.SpanContext
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		received = trace.SpanContextFromContext(otel.GetTextMapPropagator().Extract(req.Context(), propagation.HeaderCarrier(req.Header)))
+		if req.URL.Path == "/error" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	t.Cleanup(ts.Close)
+
+	client := &http.Client{Transport: newTracingTransport(http.DefaultTransport)}
+	ctx, parent := tracer.Start(context.Background(), "parent")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, ts.URL+"/ok", nil)
+	require.NoError(t, err)
+	res, err := client.Do(req)
+	require.NoError(t, err)
+	res.Body.Close()
+	parent.End()
+
+	span := findTestSpan(t, recorder.Ended(), "HTTP GET")
+	assert.Equal(t, trace.SpanKindClient, span.SpanKind())
+	assert.Equal(t, parent.SpanContext().SpanID(), span.Parent().SpanID())
+	assert.Equal(t, int64(http.StatusOK), spanAttribute(span, "http.response.status_code").AsInt64())
+	assert.Equal(t, ts.URL+"/ok", spanAttribute(span, "url.full").AsString())
+	assert.Equal(t, codes.Unset, span.Status().Code)
+	// The server receives the context of the client span
+	assert.Equal(t, span.SpanContext().TraceID(), received.TraceID())
+	assert.Equal(t, span.SpanContext().SpanID(), received.SpanID())
+	// The header of the original request is not modified
+	assert.Empty(t, req.Header.Get("traceparent"))
+
+	recorder.Reset()
+	res, err = client.Get(ts.URL + "/error")
+	require.NoError(t, err)
+	res.Body.Close()
+	span = findTestSpan(t, recorder.Ended(), "HTTP GET")
+	assert.Equal(t, codes.Error, span.Status().Code)
+
+	recorder.Reset()
+	client = &http.Client{Transport: newTracingTransport(errorTransport{})}
+	_, err = client.Get(ts.URL + "/ok")
+	require.Error(t, err)
+	span = findTestSpan(t, recorder.Ended(), "HTTP GET")
+	assert.Equal(t, codes.Error, span.Status().Code)
+	assert.Len(t, span.Events(), 1)
+}
+
+func TestProxyServer_Tracing(t *testing.T) {
+	recorder := newTestSpanRecorder()
+
+	upstream := newTestUpstream(t, map[string]string{"example.com/public@v1.0.0": "module example.com/public\n"})
+	proxy := NewModuleProxy(nil, t.TempDir(), 0, nil, nil, nil)
+	s := NewProxyServer("", nil, ServerTimeouts{}, []*url.URL{upstream}, proxy, nil, nil, nil, AccessLogFormatLogger, logr.Discard(), false)
+
+	// The trace context of the client is continued
+	traceID, err := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	require.NoError(t, err)
+	spanID, err := trace.SpanIDFromHex("00f067aa0ba902b7")
+	require.NoError(t, err)
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/example.com/public/@v/v1.0.0.info", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	s.r.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	span := findTestSpan(t, recorder.Ended(), "ProxyServer.info")
+	assert.Equal(t, trace.SpanKindServer, span.SpanKind())
+	assert.Equal(t, traceID, span.SpanContext().TraceID())
+	assert.Equal(t, spanID, span.Parent().SpanID())
+	assert.True(t, span.Parent().IsRemote())
+	assert.Equal(t, routeUpstream, spanAttribute(span, "route").AsString())
+	assert.Equal(t, "example.com/public", spanAttribute(span, "module").AsString())
+	assert.Equal(t, int64(http.StatusOK), spanAttribute(span, "http.response.status_code").AsInt64())
+	// The request to the upstream is the child of the server span
+	client := findTestSpan(t, recorder.Ended(), "HTTP GET")
+	assert.Equal(t, traceID, client.SpanContext().TraceID())
+	assert.Equal(t, span.SpanContext().SpanID(), client.Parent().SpanID())
+}
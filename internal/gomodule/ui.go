@@ -0,0 +1,291 @@
+package gomodule
+
+import (
+	"bytes"
+	"errors"
+	"html/template"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/gorilla/mux"
+	"go.f110.dev/xerrors"
+)
+
+// UIHandler serves the pages for browsing the private modules.
+//
+//	GET /_ui/                          lists the private modules
+//	GET /_ui/{module}                  shows the versions and the nested modules of the module
+//	GET /_ui/{module}/@v/{version}     shows go.mod of the version
+//
+// The modules which the client can not access are not shown.
+type UIHandler struct {
+	proxy  *ModuleProxy
+	auth   *Authenticator
+	logger logr.Logger
+}
+
+// NewUIHandler returns UIHandler. If auth is nil, the clients are not authenticated.
+func NewUIHandler(proxy *ModuleProxy, auth *Authenticator, logger logr.Logger) *UIHandler {
+	return &UIHandler{proxy: proxy, auth: auth, logger: logger}
+}
+
+func (h *UIHandler) Handler() http.Handler {
+	r := mux.NewRouter()
+	r.Methods(http.MethodGet).Path("/_ui/").HandlerFunc(h.index)
+	r.Methods(http.MethodGet).Path("/_ui/{module:.+}/@v/{version}").HandlerFunc(h.version)
+	r.Methods(http.MethodGet).Path("/_ui/{module:.+}").HandlerFunc(h.module)
+	r.Use(middlewareBrowserAuth(h.auth))
+
+	return r
+}
+
+// middlewareBrowserAuth authenticates the client of the pages. The identity is stored into the context.
+// If auth is nil, the clients are not authenticated.
+func middlewareBrowserAuth(auth *Authenticator) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			if auth == nil {
+				next.ServeHTTP(w, req)
+				return
+			}
+
+			id, err := auth.Authenticate(req)
+			switch {
+			case err == nil:
+				requestInfoFromContext(req.Context()).User = id.Name
+				req = req.WithContext(withIdentity(req.Context(), id))
+			case errors.Is(err, ErrUnauthorized) && auth.AllowAnonymous(routePrivate):
+			default:
+				w.Header().Set("WWW-Authenticate", `Basic realm="gomodule-proxy"`)
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, req)
+		})
+	}
+}
+
+type uiModule struct {
+	Path string
+	Root string
+}
+
+func (h *UIHandler) index(w http.ResponseWriter, req *http.Request) {
+	id := IdentityFromContext(req.Context())
+	seen := make(map[string]struct{})
+	var modules []uiModule
+	add := func(mod, root string) {
+		if _, ok := seen[mod]; ok {
+			return
+		}
+		if !h.proxy.IsProxy(mod) || !h.proxy.IsAllowed(mod, id) {
+			return
+		}
+		seen[mod] = struct{}{}
+		modules = append(modules, uiModule{Path: mod, Root: root})
+	}
+	// The modules in the repositories which have been fetched have the repository root
+	for _, repo := range h.proxy.Repositories() {
+		for _, v := range repo.Modules {
+			add(v, repo.Root)
+		}
+	}
+	for _, v := range h.proxy.ConfiguredModules() {
+		add(v, "")
+	}
+	sort.Slice(modules, func(i, j int) bool { return modules[i].Path < modules[j].Path })
+
+	renderPage(w, h.logger, uiIndexTemplate, struct{ Modules []uiModule }{Modules: modules})
+}
+
+type uiVersion struct {
+	Version string
+	Time    time.Time
+}
+
+func (h *UIHandler) module(w http.ResponseWriter, req *http.Request) {
+	id := IdentityFromContext(req.Context())
+	modPath := mux.Vars(req)["module"]
+	root, mod, ok := h.findModule(w, req, modPath)
+	if !ok {
+		return
+	}
+
+	var versions []uiVersion
+	for i := len(mod.Versions) - 1; i >= 0; i-- {
+		versions = append(versions, uiVersion{Version: mod.Versions[i].Semver, Time: mod.Versions[i].Time})
+	}
+	var nested []string
+	for _, v := range root.Modules {
+		if v.Path != mod.Path && h.proxy.IsAllowed(v.Path, id) {
+			nested = append(nested, v.Path)
+		}
+	}
+	sort.Strings(nested)
+	var latest string
+	if len(versions) > 0 {
+		latest = versions[0].Version
+	}
+
+	renderPage(w, h.logger, uiModuleTemplate, struct {
+		Path     string
+		Root     string
+		Latest   string
+		Versions []uiVersion
+		Modules  []string
+	}{
+		Path:     mod.Path,
+		Root:     root.RootPath,
+		Latest:   latest,
+		Versions: versions,
+		Modules:  nested,
+	})
+}
+
+func (h *UIHandler) version(w http.ResponseWriter, req *http.Request) {
+	vars := mux.Vars(req)
+	_, mod, ok := h.findModule(w, req, vars["module"])
+	if !ok {
+		return
+	}
+
+	var modVer *ModuleVersion
+	for _, v := range mod.Versions {
+		if v.Semver == vars["version"] {
+			modVer = v
+			break
+		}
+	}
+	if modVer == nil {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	goMod, err := h.proxy.GetGoMod(req.Context(), mod.Path, modVer.Semver)
+	if err != nil {
+		h.logger.Info("Failed to get go.mod", "module", mod.Path, "version", modVer.Semver, xerrors.ZapField(err))
+		http.Error(w, "failed to get go.mod", http.StatusInternalServerError)
+		return
+	}
+
+	renderPage(w, h.logger, uiVersionTemplate, struct {
+		Path    string
+		Version string
+		Time    time.Time
+		GoMod   string
+	}{
+		Path:    mod.Path,
+		Version: modVer.Semver,
+		Time:    modVer.Time,
+		GoMod:   goMod,
+	})
+}
+
+// findModule returns the module and the repository which has it.
+// If the module is not found or the client can not access it, findModule responds 404 and returns false.
+func (h *UIHandler) findModule(w http.ResponseWriter, req *http.Request, modPath string) (*ModuleRoot, *Module, bool) {
+	if !h.proxy.IsProxy(modPath) || !h.proxy.IsAllowed(modPath, IdentityFromContext(req.Context())) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return nil, nil, false
+	}
+	root, err := h.proxy.ModuleRoot(req.Context(), modPath)
+	if err != nil {
+		h.logger.Info("Failed to fetch the module", "module", modPath, xerrors.ZapField(err))
+		http.Error(w, "not found", http.StatusNotFound)
+		return nil, nil, false
+	}
+	for _, v := range root.Modules {
+		if v.Path == modPath {
+			return root, v, true
+		}
+	}
+
+	http.Error(w, "not found", http.StatusNotFound)
+	return nil, nil, false
+}
+
+func renderPage(w http.ResponseWriter, logger logr.Logger, tmpl *template.Template, data interface{}) {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		logger.Info("Failed to render the page", xerrors.ZapField(err))
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_, _ = buf.WriteTo(w)
+}
+
+const uiLayout = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{ template "title" . }} - gomodule-proxy</title>
+<style>
+body { font-family: sans-serif; margin: 2em auto; max-width: 960px; }
+table { border-collapse: collapse; }
+th, td { padding: 4px 12px; text-align: left; border-bottom: 1px solid #ddd; }
+pre { background: #f6f8fa; padding: 1em; overflow: auto; }
+</style>
+</head>
+<body>
+{{ block "nav" . }}<nav><a href="/_ui/">Modules</a></nav>{{ end }}
+{{ template "content" . }}
+</body>
+</html>
+`
+
+var (
+	uiIndexTemplate = template.Must(template.Must(template.New("layout").Parse(uiLayout)).Parse(`
+{{ define "title" }}Modules{{ end }}
+{{ define "content" }}
+<h1>Modules</h1>
+{{ if .Modules }}
+<table>
+<tr><th>Module</th><th>Repository</th></tr>
+{{ range .Modules }}<tr><td><a href="/_ui/{{ .Path }}">{{ .Path }}</a></td><td>{{ .Root }}</td></tr>
+{{ end }}
+</table>
+{{ else }}
+<p>No module is available.</p>
+{{ end }}
+{{ end }}
+`))
+
+	uiModuleTemplate = template.Must(template.Must(template.New("layout").Parse(uiLayout)).Parse(`
+{{ define "title" }}{{ .Path }}{{ end }}
+{{ define "content" }}
+<h1>{{ .Path }}</h1>
+<p>Repository: {{ .Root }}</p>
+{{ if .Latest }}<pre>go get {{ .Path }}@{{ .Latest }}</pre>{{ end }}
+<h2>Versions</h2>
+{{ if .Versions }}
+<table>
+<tr><th>Version</th><th>Time</th></tr>
+{{ range .Versions }}<tr><td><a href="/_ui/{{ $.Path }}/@v/{{ .Version }}">{{ .Version }}</a></td><td>{{ .Time.UTC.Format "2006-01-02 15:04:05 MST" }}</td></tr>
+{{ end }}
+</table>
+{{ else }}
+<p>No version is published.</p>
+{{ end }}
+{{ if .Modules }}
+<h2>Modules in the repository</h2>
+<ul>
+{{ range .Modules }}<li><a href="/_ui/{{ . }}">{{ . }}</a></li>
+{{ end }}
+</ul>
+{{ end }}
+{{ end }}
+`))
+
+	uiVersionTemplate = template.Must(template.Must(template.New("layout").Parse(uiLayout)).Parse(`
+{{ define "title" }}{{ .Path }}@{{ .Version }}{{ end }}
+{{ define "content" }}
+<h1><a href="/_ui/{{ .Path }}">{{ .Path }}</a>@{{ .Version }}</h1>
+<p>Published at {{ .Time.UTC.Format "2006-01-02 15:04:05 MST" }}</p>
+<pre>go get {{ .Path }}@{{ .Version }}</pre>
+<h2>go.mod</h2>
+<pre>{{ .GoMod }}</pre>
+{{ end }}
+`))
+)
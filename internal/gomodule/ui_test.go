@@ -0,0 +1,59 @@
+package gomodule
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUIHandler(t *testing.T) {
+	auth, err := NewAuthenticator(
+		[]BearerToken{{Name: "alice", Token: "alice-token"}, {Name: "bob", Token: "bob-token"}},
+		nil,
+		nil,
+		nil,
+		false,
+	)
+	require.NoError(t, err)
+	proxy := NewModuleProxy([]*ModuleRule{
+		{Match: regexp.MustCompile(`example.com/public`)},
+		{Match: regexp.MustCompile(`example.com/secret`), AllowedUsers: []string{"alice"}},
+		{Match: regexp.MustCompile(`^example.com/org/`)},
+	}, t.TempDir(), 0, nil, nil, nil)
+	handler := NewUIHandler(proxy, auth, logr.Discard()).Handler()
+
+	send := func(path, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := send("/_ui/", "")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.NotEmpty(t, rec.Header().Get("WWW-Authenticate"))
+
+	rec = send("/_ui/", "alice-token")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "text/html; charset=utf-8", rec.Header().Get("Content-Type"))
+	assert.Contains(t, rec.Body.String(), `href="/_ui/example.com/public"`)
+	assert.Contains(t, rec.Body.String(), `href="/_ui/example.com/secret"`)
+
+	// The module which the client can not access is hidden
+	rec = send("/_ui/", "bob-token")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `href="/_ui/example.com/public"`)
+	assert.NotContains(t, rec.Body.String(), "example.com/secret")
+	assert.Equal(t, http.StatusNotFound, send("/_ui/example.com/secret", "bob-token").Code)
+	assert.Equal(t, http.StatusNotFound, send("/_ui/example.com/secret/@v/v1.0.0", "bob-token").Code)
+	// The module which is not private is not shown
+	assert.Equal(t, http.StatusNotFound, send("/_ui/github.com/golang/go", "alice-token").Code)
+}
@@ -0,0 +1,173 @@
+package gomodule
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"go.f110.dev/xerrors"
+	"golang.org/x/mod/module"
+)
+
+// ErrNotFound is returned when the upstream responds 404 or 410.
+var ErrNotFound = xerrors.New("not found in the upstream")
+
+// Upstream is the client of the upstream module proxies.
+// The upstreams are tried in order like the list of GOPROXY.
+type Upstream struct {
+	base       *url.URL
+	httpClient *http.Client
+}
+
+func NewUpstream(upstreams []*url.URL) *Upstream {
+	return &Upstream{
+		base: upstreams[0],
+		httpClient: &http.Client{
+			Transport: &fallbackTransport{upstreams: upstreams, base: newTracingTransport(&httpTransport{})},
+			Timeout:   5 * time.Minute,
+		},
+	}
+}
+
+func (u *Upstream) Versions(ctx context.Context, mod string) ([]string, error) {
+	buf, err := u.get(ctx, mod, "/@v/list")
+	if err != nil {
+		return nil, err
+	}
+
+	return strings.Fields(string(buf)), nil
+}
+
+func (u *Upstream) GetLatestVersion(ctx context.Context, mod string) (Info, error) {
+	buf, err := u.get(ctx, mod, "/@latest")
+	if err != nil {
+		return Info{}, err
+	}
+	var info Info
+	if err := json.Unmarshal(buf, &info); err != nil {
+		return Info{}, xerrors.WithStack(err)
+	}
+
+	return info, nil
+}
+
+func (u *Upstream) GetInfo(ctx context.Context, mod, version string) (Info, error) {
+	buf, err := u.getVersion(ctx, mod, version, ArtifactInfo)
+	if err != nil {
+		return Info{}, err
+	}
+	var info Info
+	if err := json.Unmarshal(buf, &info); err != nil {
+		return Info{}, xerrors.WithStack(err)
+	}
+
+	return info, nil
+}
+
+func (u *Upstream) GetGoMod(ctx context.Context, mod, version string) ([]byte, error) {
+	return u.getVersion(ctx, mod, version, ArtifactMod)
+}
+
+func (u *Upstream) GetZip(ctx context.Context, w io.Writer, mod, version string) error {
+	escapedVersion, err := module.EscapeVersion(version)
+	if err != nil {
+		return xerrors.WithStack(err)
+	}
+	res, err := u.do(ctx, mod, "/@v/"+escapedVersion+".zip")
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if _, err := io.Copy(w, res.Body); err != nil {
+		return xerrors.WithStack(err)
+	}
+
+	return nil
+}
+
+func (u *Upstream) getVersion(ctx context.Context, mod, version, ext string) ([]byte, error) {
+	escapedVersion, err := module.EscapeVersion(version)
+	if err != nil {
+		return nil, xerrors.WithStack(err)
+	}
+
+	return u.get(ctx, mod, "/@v/"+escapedVersion+"."+ext)
+}
+
+func (u *Upstream) get(ctx context.Context, mod, suffix string) ([]byte, error) {
+	res, err := u.do(ctx, mod, suffix)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	buf, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, xerrors.WithStack(err)
+	}
+
+	return buf, nil
+}
+
+func (u *Upstream) do(ctx context.Context, mod, suffix string) (*http.Response, error) {
+	escapedPath, err := module.EscapePath(mod)
+	if err != nil {
+		return nil, xerrors.WithStack(err)
+	}
+	// The host and the base path are replaced by fallbackTransport
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.base.Scheme+"://"+u.base.Host+"/"+escapedPath+suffix, nil)
+	if err != nil {
+		return nil, xerrors.WithStack(err)
+	}
+	res, err := u.httpClient.Do(req)
+	if err != nil {
+		return nil, xerrors.WithStack(err)
+	}
+	if res.StatusCode == http.StatusNotFound || res.StatusCode == http.StatusGone {
+		res.Body.Close()
+		return nil, xerrors.Newf("%s%s: %w", mod, suffix, ErrNotFound)
+	}
+	if res.StatusCode != http.StatusOK {
+		res.Body.Close()
+		return nil, xerrors.Newf("%s%s: upstream returns %s", mod, suffix, res.Status)
+	}
+
+	return res, nil
+}
+
+// fallbackTransport sends the request to the upstreams in order.
+// When the upstream responds 404 or 410, the request is sent to the next upstream like the list of GOPROXY.
+type fallbackTransport struct {
+	upstreams []*url.URL
+	base      http.RoundTripper
+}
+
+var _ http.RoundTripper = &fallbackTransport{}
+
+func (t *fallbackTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var res *http.Response
+	for i, u := range t.upstreams {
+		r := req.Clone(req.Context())
+		r.URL.Scheme = u.Scheme
+		r.URL.Host = u.Host
+		r.URL.Path = strings.TrimSuffix(u.Path, "/") + req.URL.Path
+		r.URL.RawPath = ""
+		r.Host = u.Host
+
+		var err error
+		res, err = t.base.RoundTrip(r)
+		if err != nil {
+			return nil, err
+		}
+		if i == len(t.upstreams)-1 || (res.StatusCode != http.StatusNotFound && res.StatusCode != http.StatusGone) {
+			break
+		}
+		io.Copy(io.Discard, res.Body)
+		res.Body.Close()
+	}
+
+	return res, nil
+}
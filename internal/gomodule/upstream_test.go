@@ -0,0 +1,78 @@
+package gomodule
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFallbackTransport(t *testing.T) {
+	first := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/mirror/example.com/foo/@v/list" {
+			io.WriteString(w, "v1.0.0\n")
+			return
+		}
+		http.Error(w, "not found", http.StatusNotFound)
+	}))
+	defer first.Close()
+	second := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/example.com/bar/@v/list" {
+			io.WriteString(w, "v2.0.0\n")
+			return
+		}
+		http.Error(w, "gone", http.StatusGone)
+	}))
+	defer second.Close()
+
+	u1, err := url.Parse(first.URL + "/mirror")
+	require.NoError(t, err)
+	u2, err := url.Parse(second.URL)
+	require.NoError(t, err)
+	rr := newReverseProxy([]*url.URL{u1, u2})
+
+	cases := []struct {
+		Path   string
+		Status int
+		Body   string
+	}{
+		{Path: "/example.com/foo/@v/list", Status: http.StatusOK, Body: "v1.0.0\n"},
+		{Path: "/example.com/bar/@v/list", Status: http.StatusOK, Body: "v2.0.0\n"},
+		{Path: "/example.com/baz/@v/list", Status: http.StatusGone},
+	}
+	for _, tc := range cases {
+		rec := httptest.NewRecorder()
+		rr.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tc.Path, nil))
+		assert.Equal(t, tc.Status, rec.Code, tc.Path)
+		if tc.Body != "" {
+			assert.Equal(t, tc.Body, rec.Body.String(), tc.Path)
+		}
+	}
+}
+
+func TestReverseProxy_StripCredentials(t *testing.T) {
+	var header http.Header
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		header = req.Header.Clone()
+		io.WriteString(w, "v1.0.0\n")
+	}))
+	defer upstream.Close()
+
+	u, err := url.Parse(upstream.URL)
+	require.NoError(t, err)
+	rr := newReverseProxy([]*url.URL{u})
+
+	req := httptest.NewRequest(http.MethodGet, "/example.com/foo/@v/list", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	req.Header.Set("Proxy-Authorization", "Basic c2VjcmV0")
+	rec := httptest.NewRecorder()
+	rr.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.NotNil(t, header)
+	assert.Empty(t, header.Get("Authorization"))
+	assert.Empty(t, header.Get("Proxy-Authorization"))
+}
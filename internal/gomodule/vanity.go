@@ -0,0 +1,99 @@
+package gomodule
+
+import (
+	"html/template"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/go-logr/logr"
+)
+
+// VanityHandler answers the go-get requests (?go-get=1) of the vanity import paths with go-import and go-source meta tags.
+// The response has two go-import meta tags: "mod" which points to this proxy and "git" which points to the repository.
+// The go command prefers "mod" in module mode, so both GOPROXY and direct mode (GOPROXY=direct) can resolve the vanity import path.
+type VanityHandler struct {
+	proxy *ModuleProxy
+	auth  *Authenticator
+	// publicURL is the URL of this proxy. If nil, it is derived from the request.
+	publicURL *url.URL
+	logger    logr.Logger
+}
+
+// NewVanityHandler returns VanityHandler. If publicURL is nil, the URL of the proxy is derived from the request.
+func NewVanityHandler(proxy *ModuleProxy, auth *Authenticator, publicURL *url.URL, logger logr.Logger) *VanityHandler {
+	return &VanityHandler{proxy: proxy, auth: auth, publicURL: publicURL, logger: logger}
+}
+
+type vanityMeta struct {
+	Prefix     string
+	ProxyURL   string
+	Repository string
+	// Home, Directory and File are the templates of go-source. They are empty if the repository is not hosted on GitHub.
+	Home      string
+	Directory string
+	File      string
+}
+
+func (h *VanityHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	host := req.Host
+	if v, _, err := net.SplitHostPort(host); err == nil {
+		host = v
+	}
+	importPath := strings.TrimSuffix(host+req.URL.Path, "/")
+	rule := h.proxy.VanityRule(importPath)
+	if rule == nil {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	// The go command doesn't send the credential in most cases, so the failure of the authentication is treated as anonymous.
+	var id *Identity
+	if h.auth != nil {
+		if v, err := h.auth.Authenticate(req); err == nil {
+			id = v
+		}
+	}
+	if !rule.IsAllowed(id) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	meta := vanityMeta{
+		Prefix:     rule.VanityPrefix(),
+		ProxyURL:   h.proxyURL(req),
+		Repository: rule.Repository,
+	}
+	if u, err := url.Parse(rule.Repository); err == nil && u.Host == "github.com" {
+		meta.Home = "https://github.com" + strings.TrimSuffix(u.Path, ".git")
+		meta.Directory = meta.Home + "/tree/HEAD{/dir}"
+		meta.File = meta.Home + "/blob/HEAD{/dir}/{file}#L{line}"
+	}
+	renderPage(w, h.logger, vanityTemplate, meta)
+}
+
+func (h *VanityHandler) proxyURL(req *http.Request) string {
+	if h.publicURL != nil {
+		return strings.TrimSuffix(h.publicURL.String(), "/")
+	}
+
+	scheme := "http"
+	if req.TLS != nil || req.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + req.Host
+}
+
+var vanityTemplate = template.Must(template.New("vanity").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="go-import" content="{{ .Prefix }} mod {{ .ProxyURL }}">
+<meta name="go-import" content="{{ .Prefix }} git {{ .Repository }}">
+{{ if .Home }}<meta name="go-source" content="{{ .Prefix }} {{ .Home }} {{ .Directory }} {{ .File }}">
+{{ end }}</head>
+<body>
+go get {{ .Prefix }}
+</body>
+</html>
+`))
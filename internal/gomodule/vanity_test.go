@@ -0,0 +1,50 @@
+package gomodule
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVanityHandler(t *testing.T) {
+	proxy := NewModuleProxy([]*ModuleRule{
+		{Match: regexp.MustCompile(`^go\.example\.com/foo(/|$)`), Repository: "https://github.com/example/foo.git", Prefix: "go.example.com/foo"},
+		{Match: regexp.MustCompile(`^go\.example\.com/secret(/|$)`), Repository: "https://git.example.com/secret", Prefix: "go.example.com/secret", AllowedUsers: []string{"alice"}},
+		{Match: regexp.MustCompile(`^github.com/example/`)},
+	}, t.TempDir(), 0, nil, nil, nil)
+
+	repoRoot, err := proxy.resolveRepoRoot("go.example.com/foo/pkg/api")
+	require.NoError(t, err)
+	assert.Equal(t, "go.example.com/foo", repoRoot.Root)
+	assert.Equal(t, "https://github.com/example/foo.git", repoRoot.Repo)
+	assert.Nil(t, proxy.VanityRule("go.example.com/foobar"))
+	assert.True(t, proxy.IsProxy("go.example.com/foo"))
+	assert.False(t, proxy.IsProxy("go.example.com/foobar"))
+	assert.Contains(t, proxy.ConfiguredModules(), "go.example.com/foo")
+
+	publicURL, err := url.Parse("https://proxy.example.com/")
+	require.NoError(t, err)
+	h := NewVanityHandler(proxy, nil, publicURL, logr.Discard())
+
+	req := httptest.NewRequest(http.MethodGet, "https://go.example.com/foo/pkg/api?go-get=1", nil)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `<meta name="go-import" content="go.example.com/foo mod https://proxy.example.com">`)
+	assert.Contains(t, rec.Body.String(), `<meta name="go-import" content="go.example.com/foo git https://github.com/example/foo.git">`)
+	assert.Contains(t, rec.Body.String(), `<meta name="go-source" content="go.example.com/foo https://github.com/example/foo https://github.com/example/foo/tree/HEAD{/dir} https://github.com/example/foo/blob/HEAD{/dir}/{file}#L{line}">`)
+
+	// The module which the anonymous client can not access is not found
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "https://go.example.com/secret?go-get=1", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "https://github.com/example/bar?go-get=1", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
@@ -0,0 +1,167 @@
+package gomodule
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"go.f110.dev/xerrors"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/module"
+)
+
+// Warm clones or updates the repository of the module and stores the artifacts of the version into the cache.
+// If version is empty, the latest version is warmed.
+func (m *ModuleProxy) Warm(ctx context.Context, mod, version string) error {
+	ctx, span := tracer.Start(ctx, "ModuleProxy.Warm", trace.WithAttributes(attribute.String("module", mod), attribute.String("version", version)))
+	defer span.End()
+
+	if !m.IsProxy(mod) {
+		return xerrors.Newf("%s is not a private module", mod)
+	}
+	if version == "" {
+		info, err := m.GetLatestVersion(ctx, mod)
+		if err != nil {
+			return err
+		}
+		version = info.Version
+	}
+
+	if _, err := m.GetInfo(ctx, mod, version); err != nil {
+		return err
+	}
+	if _, err := m.GetGoMod(ctx, mod, version); err != nil {
+		return err
+	}
+	if err := m.GetZip(ctx, io.Discard, mod, version); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// WarmModules warms the modules with at most concurrency goroutines.
+// done is called with the result of each module. It may be called concurrently.
+func (m *ModuleProxy) WarmModules(ctx context.Context, mods []module.Version, concurrency int, done func(mod module.Version, err error)) {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for _, v := range mods {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			wg.Wait()
+			return
+		}
+
+		wg.Add(1)
+		go func(mod module.Version) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			done(mod, m.Warm(ctx, mod.Path, mod.Version))
+		}(v)
+	}
+	wg.Wait()
+}
+
+// ReadModuleList reads the list of the modules from the file.
+// go.mod, go.sum and go.work are parsed by its format. In go.work, the requirements of the used modules are read.
+// Otherwise, the file is the list of module@version. The line which starts with # is ignored.
+// The version may be omitted and it means the latest version.
+func ReadModuleList(path string) ([]module.Version, error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, xerrors.WithStack(err)
+	}
+
+	switch filepath.Base(path) {
+	case "go.mod":
+		f, err := modfile.ParseLax(path, buf, nil)
+		if err != nil {
+			return nil, xerrors.WithStack(err)
+		}
+		var mods []module.Version
+		for _, v := range f.Require {
+			mods = append(mods, v.Mod)
+		}
+		return mods, nil
+	case "go.work":
+		f, err := modfile.ParseWork(path, buf, nil)
+		if err != nil {
+			return nil, xerrors.WithStack(err)
+		}
+		var mods []module.Version
+		for _, v := range f.Use {
+			m, err := ReadModuleList(filepath.Join(filepath.Dir(path), v.Path, "go.mod"))
+			if err != nil {
+				return nil, err
+			}
+			mods = append(mods, m...)
+		}
+		return uniqueModules(mods), nil
+	case "go.sum":
+		var mods []module.Version
+		s := bufio.NewScanner(bytes.NewReader(buf))
+		for s.Scan() {
+			f := strings.Fields(s.Text())
+			if len(f) != 3 {
+				continue
+			}
+			mods = append(mods, module.Version{Path: f[0], Version: strings.TrimSuffix(f[1], "/go.mod")})
+		}
+		return uniqueModules(mods), nil
+	default:
+		return ParseModuleList(bytes.NewReader(buf))
+	}
+}
+
+// ParseModuleList parses the list of module@version.
+func ParseModuleList(r io.Reader) ([]module.Version, error) {
+	var mods []module.Version
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		mods = append(mods, ParseModuleVersion(line))
+	}
+	if err := s.Err(); err != nil {
+		return nil, xerrors.WithStack(err)
+	}
+
+	return uniqueModules(mods), nil
+}
+
+// ParseModuleVersion parses module@version. The version is empty if it is omitted.
+func ParseModuleVersion(s string) module.Version {
+	p, v, _ := strings.Cut(s, "@")
+	return module.Version{Path: p, Version: v}
+}
+
+func uniqueModules(mods []module.Version) []module.Version {
+	seen := make(map[module.Version]struct{})
+	var unique []module.Version
+	for _, v := range mods {
+		if _, ok := seen[v]; ok {
+			continue
+		}
+		seen[v] = struct{}{}
+		unique = append(unique, v)
+	}
+
+	return unique
+}
@@ -0,0 +1,62 @@
+package gomodule
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/mod/module"
+)
+
+func TestReadModuleList(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"go.mod": `module example.com/foo
+
+go 1.24
+
+require (
+	example.com/bar v1.0.0
+	example.com/baz v0.2.0 // indirect
+)
+`,
+		"go.sum": `example.com/bar v1.0.0 h1:AAAA=
+example.com/bar v1.0.0/go.mod h1:BBBB=
+example.com/baz v0.2.0/go.mod h1:CCCC=
+`,
+		"go.work": `go 1.24
+
+use ./sub
+`,
+		"sub/go.mod": `module example.com/foo/sub
+
+require example.com/qux v1.2.3
+`,
+		"modules.txt": `# private modules
+example.com/bar@v1.0.0
+example.com/qux
+
+example.com/bar@v1.0.0
+`,
+	}
+	for name, content := range files {
+		require.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0644))
+	}
+
+	cases := map[string][]module.Version{
+		"go.mod":      {{Path: "example.com/bar", Version: "v1.0.0"}, {Path: "example.com/baz", Version: "v0.2.0"}},
+		"go.sum":      {{Path: "example.com/bar", Version: "v1.0.0"}, {Path: "example.com/baz", Version: "v0.2.0"}},
+		"go.work":     {{Path: "example.com/qux", Version: "v1.2.3"}},
+		"modules.txt": {{Path: "example.com/bar", Version: "v1.0.0"}, {Path: "example.com/qux"}},
+	}
+	for name, expect := range cases {
+		t.Run(name, func(t *testing.T) {
+			mods, err := ReadModuleList(filepath.Join(dir, name))
+			require.NoError(t, err)
+			assert.Equal(t, expect, mods)
+		})
+	}
+}
@@ -0,0 +1,173 @@
+package gomodule
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/gorilla/mux"
+	"go.f110.dev/xerrors"
+)
+
+const (
+	webhookMaxBodySize  = 10 << 20
+	webhookFetchTimeout = 5 * time.Minute
+)
+
+// WebhookHandler receives the webhook of the push and refreshes the repository.
+//
+// POST /_webhook/github receives the webhook of GitHub. The signature is verified by X-Hub-Signature-256.
+// POST /_webhook/generic receives {"repository": "example.com/org/repo"}. The signature is verified by X-Signature-256.
+// Both signatures are "sha256=" + hex encoded HMAC-SHA256 of the body.
+type WebhookHandler struct {
+	proxy  *ModuleProxy
+	secret []byte
+	logger logr.Logger
+
+	// refresh is replaced in the test
+	refresh func(ctx context.Context, module string) error
+}
+
+func NewWebhookHandler(proxy *ModuleProxy, secret string, logger logr.Logger) (*WebhookHandler, error) {
+	if secret == "" {
+		return nil, xerrors.New("the secret of the webhook is required")
+	}
+
+	return &WebhookHandler{proxy: proxy, secret: []byte(secret), logger: logger, refresh: proxy.Refresh}, nil
+}
+
+func (h *WebhookHandler) Handler() http.Handler {
+	r := mux.NewRouter()
+	r.Methods(http.MethodPost).Path("/_webhook/github").HandlerFunc(h.github)
+	r.Methods(http.MethodPost).Path("/_webhook/generic").HandlerFunc(h.generic)
+
+	return r
+}
+
+type githubWebhookPayload struct {
+	Ref        string `json:"ref"`
+	RefType    string `json:"ref_type"`
+	Repository struct {
+		FullName string `json:"full_name"`
+		HTMLURL  string `json:"html_url"`
+	} `json:"repository"`
+}
+
+func (h *WebhookHandler) github(w http.ResponseWriter, req *http.Request) {
+	body, ok := h.verify(w, req, "X-Hub-Signature-256")
+	if !ok {
+		return
+	}
+
+	event := req.Header.Get("X-GitHub-Event")
+	var payload githubWebhookPayload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		http.Error(w, "malformed payload", http.StatusBadRequest)
+		return
+	}
+	switch {
+	case event == "ping":
+		w.WriteHeader(http.StatusOK)
+		return
+	case event == "push":
+	case event == "create" && payload.RefType == "tag":
+	default:
+		// The event which doesn't change the versions
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	repo := payload.Repository.HTMLURL
+	if repo == "" {
+		repo = "https://github.com/" + payload.Repository.FullName
+	}
+	h.trigger(w, repoPathFromURL(repo))
+}
+
+type genericWebhookPayload struct {
+	// Repository is the repository root path (e.g. github.com/org/repo) or the URL of the repository.
+	Repository string `json:"repository"`
+}
+
+func (h *WebhookHandler) generic(w http.ResponseWriter, req *http.Request) {
+	body, ok := h.verify(w, req, "X-Signature-256")
+	if !ok {
+		return
+	}
+
+	var payload genericWebhookPayload
+	if err := json.Unmarshal(body, &payload); err != nil || payload.Repository == "" {
+		http.Error(w, "malformed payload", http.StatusBadRequest)
+		return
+	}
+	h.trigger(w, repoPathFromURL(payload.Repository))
+}
+
+// verify reads the body and verifies the signature in the header.
+func (h *WebhookHandler) verify(w http.ResponseWriter, req *http.Request, header string) ([]byte, bool) {
+	body, err := io.ReadAll(io.LimitReader(req.Body, webhookMaxBodySize))
+	if err != nil {
+		http.Error(w, "failed to read the body", http.StatusBadRequest)
+		return nil, false
+	}
+	sig, ok := strings.CutPrefix(req.Header.Get(header), "sha256=")
+	if !ok {
+		http.Error(w, "signature is required", http.StatusUnauthorized)
+		return nil, false
+	}
+	expected, err := hex.DecodeString(sig)
+	if err != nil {
+		http.Error(w, "malformed signature", http.StatusUnauthorized)
+		return nil, false
+	}
+	mac := hmac.New(sha256.New, h.secret)
+	mac.Write(body)
+	if !hmac.Equal(mac.Sum(nil), expected) {
+		http.Error(w, "signature mismatch", http.StatusUnauthorized)
+		return nil, false
+	}
+
+	return body, true
+}
+
+// trigger fetches the repository in the background. The repository which is not served by ModuleProxy is ignored.
+func (h *WebhookHandler) trigger(w http.ResponseWriter, repo string) {
+	modules := h.proxy.RepositoryModules(repo)
+	if len(modules) == 0 {
+		h.logger.Info("Ignore the webhook of the repository which is not a private module", "repository", repo)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	h.logger.Info("Refreshing the repository by the webhook", "repository", repo, "modules", modules)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), webhookFetchTimeout)
+		defer cancel()
+		for _, mod := range modules {
+			if err := h.refresh(ctx, mod); err != nil {
+				h.logger.Info("Failed to refresh the repository", "repository", repo, "module", mod, xerrors.ZapField(err))
+			}
+		}
+	}()
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// repoPathFromURL returns the import path of the repository from the URL (e.g. https://github.com/org/repo.git -> github.com/org/repo).
+func repoPathFromURL(u string) string {
+	for _, prefix := range []string{"https://", "http://", "ssh://", "git://"} {
+		u = strings.TrimPrefix(u, prefix)
+	}
+	if i := strings.Index(u, "@"); i != -1 && i < strings.Index(u, "/") {
+		// git@github.com:org/repo
+		u = strings.Replace(u[i+1:], ":", "/", 1)
+	}
+
+	return strings.TrimSuffix(strings.TrimSuffix(u, "/"), ".git")
+}
@@ -0,0 +1,74 @@
+package gomodule
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/tools/go/vcs"
+)
+
+func TestWebhookHandler(t *testing.T) {
+	proxy := NewModuleProxy([]*ModuleRule{
+		{Match: regexp.MustCompile(`^github.com/f110/`)},
+		{Match: regexp.MustCompile(`^go\.example\.com/lib(/|$)`), Repository: "https://github.com/example/lib.git", Prefix: "go.example.com/lib"},
+		{Match: regexp.MustCompile(`^go\.example\.com/`)},
+	}, t.TempDir(), 0, nil, nil, nil)
+	// The repository of the module which is resolved by the go-get protocol has been fetched
+	proxy.fetcher.repository("go.example.com/app").repoRoot = &vcs.RepoRoot{Repo: "https://git.example.com/app", Root: "go.example.com/app"}
+	h, err := NewWebhookHandler(proxy, "secret", logr.Discard())
+	require.NoError(t, err)
+	refreshed := make(chan string, 1)
+	h.refresh = func(_ context.Context, module string) error {
+		refreshed <- module
+		return nil
+	}
+	handler := h.Handler()
+
+	sign := func(body string) string {
+		mac := hmac.New(sha256.New, []byte("secret"))
+		mac.Write([]byte(body))
+		return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	}
+	send := func(path, event, body, signature string) int {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set("X-GitHub-Event", event)
+		req.Header.Set("X-Hub-Signature-256", signature)
+		req.Header.Set("X-Signature-256", signature)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	body := `{"ref":"refs/tags/v1.0.0","repository":{"full_name":"f110/gomodule-proxy","html_url":"https://github.com/f110/gomodule-proxy"}}`
+	assert.Equal(t, http.StatusUnauthorized, send("/_webhook/github", "push", body, ""))
+	assert.Equal(t, http.StatusUnauthorized, send("/_webhook/github", "push", body, sign("other")))
+	assert.Equal(t, http.StatusNoContent, send("/_webhook/github", "issues", body, sign(body)))
+	assert.Equal(t, http.StatusAccepted, send("/_webhook/github", "push", body, sign(body)))
+	assert.Equal(t, "github.com/f110/gomodule-proxy", <-refreshed)
+
+	body = `{"repository":"git@github.com:f110/mono.git"}`
+	assert.Equal(t, http.StatusAccepted, send("/_webhook/generic", "", body, sign(body)))
+	assert.Equal(t, "github.com/f110/mono", <-refreshed)
+
+	// The repository of the vanity import path
+	body = `{"repository":"https://github.com/example/lib"}`
+	assert.Equal(t, http.StatusAccepted, send("/_webhook/generic", "", body, sign(body)))
+	assert.Equal(t, "go.example.com/lib", <-refreshed)
+	body = `{"repository":"https://git.example.com/app.git"}`
+	assert.Equal(t, http.StatusAccepted, send("/_webhook/generic", "", body, sign(body)))
+	assert.Equal(t, "go.example.com/app", <-refreshed)
+
+	// The repository which is not a private module is ignored
+	body = `{"repository":"github.com/golang/go"}`
+	assert.Equal(t, http.StatusNoContent, send("/_webhook/generic", "", body, sign(body)))
+}